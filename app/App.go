@@ -1,16 +1,16 @@
 // Package app provides generic functionality for the K-Way Merger application.
 // It handles reading input files, sorting their contents, and merging them
 // using a min-heap to produce a single sorted output file with support for any type.
+// Besides file paths, inputs and output can be arbitrary io.Reader and io.Writer streams.
 package app
 
 import (
 	myHeap "KWayMerger/heap"
-	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"runtime"
-	"sort"
-	"sync"
+	"time"
 )
 
 // ParseFunc defines a function type for parsing a string into type T.
@@ -19,267 +19,349 @@ type ParseFunc[T any] func(string) (T, error)
 // FormatFunc defines a function type for formatting a value of type T into a string.
 type FormatFunc[T any] func(T) string
 
+// ReduceFunc defines a function type for combining a group of values of type T that
+// compare equal into a single value. The group is never empty.
+type ReduceFunc[T any] func([]T) T
+
 // NewNode opens the given file, reads its first value using the provided parser,
 // and returns a Node[T]. If any error occurs, it closes the file before returning.
+//
+// Deprecated: Merges read their inputs as io.Readers and no longer through nodes. Use
+// Merge or MergeStreams to merge files or readers.
 func NewNode[T any](filename string, parser ParseFunc[T]) (myHeap.Node[T], error) {
-	fd, err := os.Open(filename)
-	if err != nil {
-		return myHeap.Node[T]{}, fmt.Errorf("open file %s: %w", filename, err)
-	}
-
-	scanner := bufio.NewScanner(fd)
-	scanner.Split(bufio.ScanWords)
-
-	if !scanner.Scan() {
-		// Close on failure to read
-		fd.Close()
-		if scanErr := scanner.Err(); scanErr != nil {
-			return myHeap.Node[T]{}, fmt.Errorf("scan file %s: %w", filename, scanErr)
-		}
-		return myHeap.Node[T]{}, fmt.Errorf("no value found in file %s", filename)
-	}
+	return myHeap.NewNode(filename, parser)
+}
 
-	val, err := parser(scanner.Text())
-	if err != nil {
-		fd.Close()
-		return myHeap.Node[T]{}, fmt.Errorf("parse value in file %s: %w", filename, err)
-	}
+// Run is the generic entry point for the K-Way Merger application.
+// It sorts each input file individually using the provided parser, formatter, and comparator,
+// then merges them into a single sorted output file. The run can be configured with
+// options such as WithConcurrency, WithMemoryLimit or WithPreserveInputs.
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing unsorted values
+//	outputFile - Path to the output file where merged sorted values will be written
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the run
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func Run[T any](inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) error {
+	return run(context.Background(), inputFiles, outputFile, parser, formatter, cmp, newRunConfig(opts...))
+}
 
-	return myHeap.Node[T]{Val: val, Fd: fd, Scanner: scanner}, nil
+// RunWithMemoryLimit is like Run, but bounds the memory used by the sort phase so that
+// inputs larger than the available memory can be sorted.
+//
+// The limit is shared between the concurrent sorting goroutines. An input whose values
+// do not fit into its share is left unmodified; its contents are instead split into sorted
+// runs written to a temporary directory created under spillDir, and those runs are merged
+// together with the other inputs. The temporary directory is removed before returning.
+//
+// RunWithMemoryLimit is equivalent to Run with the options WithMemoryLimit(memoryLimit)
+// and WithTempDir(spillDir).
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing unsorted values
+//	outputFile - Path to the output file where merged sorted values will be written
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	memoryLimit - Approximate number of bytes of values to hold in memory, or 0 for no limit
+//	spillDir - Directory in which to create sorted runs, or "" for the default temporary directory
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func RunWithMemoryLimit[T any](inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, memoryLimit int64, spillDir string) error {
+	return RunContext(context.Background(), inputFiles, outputFile, parser, formatter, cmp, WithMemoryLimit(memoryLimit), WithTempDir(spillDir))
 }
 
-// readSortRewrite reads values of type T from a file, sorts them using the provided comparator,
-// and rewrites the sorted values back to the same file using the provided formatter.
+// RunReadOnly is like RunWithMemoryLimit, but treats the input files as read-only.
+//
+// Instead of being rewritten in place, every input is sorted into one or more runs in a
+// temporary directory created under tempDir. The temporary directory is removed before
+// returning, whether the run succeeds or fails, so the input files are left byte-identical.
+//
+// RunReadOnly is equivalent to Run with the options WithMemoryLimit(memoryLimit),
+// WithTempDir(tempDir) and WithPreserveInputs(true).
 //
 // Parameters:
 //
-//	file - The path to the file to be read, sorted, and rewritten
+//	inputFiles - Slice of paths to the input files containing unsorted values
+//	outputFile - Path to the output file where merged sorted values will be written
 //	parser - Function to parse string values into type T
 //	formatter - Function to format values of type T into strings
-//	cmp - Comparator function for sorting values of type T
+//	cmp - Comparator function for ordering values of type T
+//	memoryLimit - Approximate number of bytes of values to hold in memory, or 0 for no limit
+//	tempDir - Directory in which to create sorted runs, or "" for the default temporary directory
 //
 // Returns:
 //
-//	error - Any error encountered during reading, sorting, or writing
-func readSortRewrite[T any](file string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool) error {
-	// Open file for reading
-	fd, err := os.Open(file)
-	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", file, err)
-	}
-	// Ensure file is closed when function exits
-	defer func() {
-		closeErr := fd.Close()
-		if closeErr != nil && err == nil {
-			err = fmt.Errorf("failed to close file %s: %w", file, closeErr)
-		}
-	}()
+//	error - Any error encountered during the process
+func RunReadOnly[T any](inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, memoryLimit int64, tempDir string) error {
+	return RunContext(context.Background(), inputFiles, outputFile, parser, formatter, cmp, WithMemoryLimit(memoryLimit), WithTempDir(tempDir), WithPreserveInputs(true))
+}
 
-	// Read values from file
-	scanner := bufio.NewScanner(fd)
-	scanner.Split(bufio.ScanWords) // Split on whitespace
-	var list []T
-	for scanner.Scan() {
-		val, parseErr := parser(scanner.Text())
-		if parseErr != nil {
-			return fmt.Errorf("failed to parse value in file %s: %w", file, parseErr)
-		}
-		list = append(list, val)
-	}
-	if err = scanner.Err(); err != nil {
-		return fmt.Errorf("error reading file %s: %w", file, err)
-	}
+// RunContext is like Run, but stops as soon as ctx is canceled or any input file fails
+// to sort. In-flight sorting goroutines stop reading their files, no further files are
+// sorted, and the merge is aborted. All open files are closed and the partially written
+// output file is removed before RunContext returns the error of ctx.
+//
+// An input file that is being rewritten with its sorted contents when ctx is canceled is
+// still written completely, so input files are never left truncated.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation stops the run
+//	inputFiles - Slice of paths to the input files containing unsorted values
+//	outputFile - Path to the output file where merged sorted values will be written
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the run
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func RunContext[T any](ctx context.Context, inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) error {
+	return run(ctx, inputFiles, outputFile, parser, formatter, cmp, newRunConfig(opts...))
+}
 
-	// Sort the values using the provided comparator
-	sort.Slice(list, func(i, j int) bool {
-		return cmp(list[i], list[j])
-	})
+// Merge merges input files that are already sorted into a single sorted output file.
+// Unlike Run, it skips the sort phase and never modifies the input files: values are
+// streamed from the inputs straight into the merge. Each input is checked while it is
+// read, and Merge fails with the file and record number of the first value that is less
+// than its predecessor according to cmp.
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing sorted values
+//	outputFile - Path to the output file where merged sorted values will be written
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the merge
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func Merge[T any](inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) error {
+	return merge(context.Background(), inputFiles, outputFile, parser, formatter, cmp, newRunConfig(opts...))
+}
 
-	// Open file for writing (truncate existing content)
-	fd2, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+// RunStreams is like Run with WithPreserveInputs(true), but reads unsorted values from
+// arbitrary readers and writes the merged values to w, one per line. Since readers cannot be
+// rewritten, every input is sorted into runs in a temporary directory created under the
+// directory set by WithTempDir, which is removed before returning. WithMemoryLimit bounds
+// the values held in memory while sorting. The readers are read concurrently and are not
+// closed. WithPreserveInputs is ignored.
+//
+// Parameters:
+//
+//	inputs - Readers providing unsorted values, whitespace-separated unless split otherwise by opts
+//	w - Writer receiving the merged sorted values
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the run
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func RunStreams[T any](inputs []io.Reader, w io.Writer, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) error {
+	cfg := newRunConfig(opts...)
+	cfg.preserveInputs = true
+	concurrency := sortConcurrency(len(inputs), cfg)
+	budget, runDir, err := prepareRuns(cfg, concurrency, false)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s for writing: %w", file, err)
+		return err
 	}
-	// Ensure file is closed when function exits
-	defer func() {
-		closeErr := fd2.Close()
-		if closeErr != nil && err == nil {
-			err = fmt.Errorf("failed to close file %s: %w", file, closeErr)
-		}
-	}()
-
-	// Write sorted values back to file
-	for i := 0; i < len(list); i++ {
-		_, err = fmt.Fprintf(fd2, "%s\n", formatter(list[i]))
+	defer os.RemoveAll(runDir)
+
+	// Sort each input into runs
+	cfg.progress.startPhase(PhaseSort)
+	cfg.stats.startSort(len(inputs))
+	sortStart := time.Now()
+	sortedFiles, err := sortPhase(context.Background(), len(inputs), concurrency, func(ctx context.Context, i int) ([]string, error) {
+		name := fmt.Sprintf("input %d", i)
+		tracker := newInputTracker(cfg, i, name)
+		runs, err := readSortSpill(ctx, name, inputs[i], parser, formatter, cmp, budget, runDir, tracker, cfg)
 		if err != nil {
-			return fmt.Errorf("failed to write to file %s: %w", file, err)
+			return nil, err
 		}
+		tracker.finish()
+		return runs, nil
+	})
+	cfg.stats.timeSort(sortStart)
+	if err != nil {
+		return fmt.Errorf("failed to sort inputs: %w", err)
 	}
 
-	// Sync file to ensure data is written to disk
-	err = fd2.Sync()
-	if err != nil {
-		return fmt.Errorf("failed to sync file %s: %w", file, err)
+	// Merge the runs, which are never compressed, into the output stream
+	defer cfg.stats.timeMerge(time.Now())
+	cfg.inputCompression = CompressionNone
+	if err = mergeFiles(context.Background(), sortedFiles, w, parser, formatter, cmp, false, cfg); err != nil {
+		return fmt.Errorf("failed to merge inputs: %w", err)
 	}
 
 	return nil
 }
 
-// mergeAndWrite merges values of type T from multiple sorted input files into a single
-// sorted output file using a min-heap. It reads the smallest available value
-// from each input file, adds it to the heap, and then extracts the minimum
-// value to write to the output file.
+// MergeStreams is like Merge, but reads already sorted values from arbitrary readers and
+// writes the merged values to w, one per line. Inputs are named by their index in error
+// messages. The readers are not closed.
 //
 // Parameters:
 //
-//	inputFiles - Slice of paths to the input files containing sorted values
-//	outputFile - Path to the output file where merged sorted values will be written
+//	inputs - Readers providing sorted values, whitespace-separated unless split otherwise by opts
+//	w - Writer receiving the merged sorted values
 //	parser - Function to parse string values into type T
 //	formatter - Function to format values of type T into strings
 //	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the merge
 //
 // Returns:
 //
-//	error - Any error encountered during merging or writing
-func mergeAndWrite[T any](inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool) error {
-	// Open output file for writing
-	fd, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open output file %s: %w", outputFile, err)
-	}
-	// Ensure output file is closed when function exits
-	defer func() {
-		closeErr := fd.Close()
-		if closeErr != nil && err == nil {
-			err = fmt.Errorf("failed to close output file %s: %w", outputFile, closeErr)
-		}
-	}()
-
-	// Initialize min-heap with the provided comparator
-	minHeap := myHeap.NewHeap(len(inputFiles), cmp)
-
-	// Track all open files for proper cleanup
-	var openFiles []*os.File
-	defer func() {
-		// Close all remaining open files on error
-		for _, f := range openFiles {
-			f.Close()
+//	error - Any error encountered during the process
+func MergeStreams[T any](inputs []io.Reader, w io.Writer, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) error {
+	cfg := newRunConfig(opts...)
+	sources := make([]*source[T], len(inputs))
+	for i, r := range inputs {
+		name := fmt.Sprintf("input %d", i)
+		r, _, err := decompress(name, r, cfg.inputCompression)
+		if err != nil {
+			return fmt.Errorf("failed to merge inputs: %w", err)
 		}
-	}()
+		sources[i] = newSource(name, r, nil, parser, cfg)
+	}
 
-	// Create nodes for each input file and add to heap
-	for i := range inputFiles {
-		node, newErr := NewNode(inputFiles[i], parser)
-		if newErr != nil {
-			return fmt.Errorf("failed to create node for file %s: %w", inputFiles[i], newErr)
-		}
-		openFiles = append(openFiles, node.Fd)
-		minHeap.PushNode(node)
+	defer cfg.stats.timeMerge(time.Now())
+	if err := mergeSources(context.Background(), sources, w, formatter, cmp, true, cfg); err != nil {
+		return fmt.Errorf("failed to merge inputs: %w", err)
 	}
 
-	// Merge process: extract minimum value from heap and write to output
-	for !minHeap.Empty() {
-		node := minHeap.PopNode()
-		// Write the smallest value to output file
-		_, err = fmt.Fprintf(fd, "%s\n", formatter(node.Val))
-		if err != nil {
-			return fmt.Errorf("failed to write to output file %s: %w", outputFile, err)
-		}
+	return nil
+}
 
-		// Read next value from the same file if available
-		if node.Scanner.Scan() {
-			val, parseErr := parser(node.Scanner.Text())
-			if parseErr != nil {
-				return fmt.Errorf("failed to parse value in file %s: %w", node.Fd.Name(), parseErr)
-			}
-			node.Val = val
-			minHeap.PushNode(node) // Reinsert node with new value
-		} else {
-			// File is exhausted, remove from open files list
-			for i, f := range openFiles {
-				if f == node.Fd {
-					openFiles = append(openFiles[:i], openFiles[i+1:]...)
-					break
-				}
-			}
+// run sorts the input files and merges them into outputFile according to cfg.
+func run[T any](ctx context.Context, inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, cfg runConfig) error {
+	inputFiles, err := expandInputs(inputFiles, cfg)
+	if err != nil {
+		return err
+	}
+	sortedFiles, runDir, err := sortFiles(ctx, inputFiles, parser, formatter, cmp, cfg)
+	if err != nil {
+		return err
+	}
+	// Remove the runs once they are merged, whether the merge succeeds or fails
+	defer removeRuns(runDir)
+	// The sorted files and runs are never compressed
+	cfg.inputCompression = CompressionNone
 
-			// Close the file
-			closeErr := node.Fd.Close()
-			if closeErr != nil {
-				return fmt.Errorf("failed to close file: %w", closeErr)
-			}
-		}
+	// Merge the sorted files and runs, keeping the order of the inputs
+	if err = mergeAndWrite(ctx, sortedFiles, outputFile, parser, formatter, cmp, false, cfg); err != nil {
+		return fmt.Errorf("failed to merge files: %w", err)
 	}
 
-	// Sync output file to ensure data is written to disk
-	err = fd.Sync()
+	return nil
+}
+
+// merge merges the sorted input files into outputFile according to cfg, checking that they
+// are sorted.
+func merge[T any](ctx context.Context, inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, cfg runConfig) error {
+	inputFiles, err := expandInputs(inputFiles, cfg)
 	if err != nil {
-		return fmt.Errorf("failed to sync output file %s: %w", outputFile, err)
+		return err
+	}
+	if err = mergeAndWrite(ctx, inputFiles, outputFile, parser, formatter, cmp, true, cfg); err != nil {
+		return fmt.Errorf("failed to merge files: %w", err)
 	}
 
 	return nil
 }
 
-// Run is the generic entry point for the K-Way Merger application.
-// It sorts each input file individually using the provided parser, formatter, and comparator,
-// then merges them into a single sorted output file.
-//
-// Parameters:
-//
-//	inputFiles - Slice of paths to the input files containing unsorted values
-//	outputFile - Path to the output file where merged sorted values will be written
-//	parser - Function to parse string values into type T
-//	formatter - Function to format values of type T into strings
-//	cmp - Comparator function for ordering values of type T
-//	concurrency - Number of concurrent goroutines to use for sorting
+// sortFiles sorts each input file according to cfg, in place or into runs in a new
+// temporary directory. On success the caller must remove the directory with removeRuns;
+// on failure, including the cancellation of ctx, it has already been removed.
 //
 // Returns:
 //
-//	error - Any error encountered during the process
-func Run[T any](inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool) error {
-	// Limit concurrency to number of input files if necessary
-	// Get the number of CPU cores for concurrency, limit concurrency to number of input files if necessary
-	concurrency := runtime.NumCPU()
-	if concurrency > len(inputFiles) {
-		concurrency = len(inputFiles)
+//	[]string - The paths of the sorted files and runs to merge, in input order
+//	string - The path of the temporary directory, or "" if it was not needed
+//	error - Any error encountered while sorting
+func sortFiles[T any](ctx context.Context, inputFiles []string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, cfg runConfig) ([]string, string, error) {
+	concurrency := sortConcurrency(len(inputFiles), cfg)
+	// Compressed files are sorted into runs, since they are never rewritten
+	compressed, err := anyCompressed(inputFiles, cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sort input files: %w", err)
+	}
+	budget, runDir, err := prepareRuns(cfg, concurrency, compressed)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Create a semaphore to control concurrency
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
-	var errMu sync.Mutex
-	var firstErr error
+	// Sort each input file, in place or into runs
+	cfg.progress.startPhase(PhaseSort)
+	cfg.stats.startSort(len(inputFiles))
+	defer cfg.stats.timeSort(time.Now())
+	sortedFiles, err := sortPhase(ctx, len(inputFiles), concurrency, func(ctx context.Context, i int) ([]string, error) {
+		tracker := newInputTracker(cfg, i, inputFiles[i])
+		runs, err := readSortRewrite(ctx, inputFiles[i], parser, formatter, cmp, budget, runDir, tracker, cfg)
+		if err != nil {
+			return nil, err
+		}
+		tracker.finish()
+		return runs, nil
+	})
+	if err != nil {
+		removeRuns(runDir)
+		return nil, "", fmt.Errorf("failed to sort input files: %w", err)
+	}
 
-	// Sort each input file in parallel
-	for _, file := range inputFiles {
-		sem <- struct{}{} // Acquire semaphore
-		wg.Add(1)
-		go func(file string) {
-			defer wg.Done()
-			defer func() { <-sem }() // Release semaphore
+	return sortedFiles, runDir, nil
+}
 
-			if err := readSortRewrite(file, parser, formatter, cmp); err != nil {
-				errMu.Lock()
-				if firstErr == nil {
-					firstErr = err
-				}
-				errMu.Unlock()
-			}
-		}(file)
+// removeRuns removes the temporary directory of runs created by prepareRuns, if any.
+func removeRuns(runDir string) {
+	if runDir != "" {
+		os.RemoveAll(runDir)
 	}
+}
 
-	// Wait for all sorting goroutines to complete
-	wg.Wait()
+// sortConcurrency returns the number of goroutines used to sort n inputs according to cfg.
+func sortConcurrency(n int, cfg runConfig) int {
+	// Limit concurrency to number of inputs if necessary
+	return min(cfg.concurrency, n)
+}
 
-	// Check if any sorting operation failed
-	if firstErr != nil {
-		return fmt.Errorf("failed to sort input files: %w", firstErr)
+// prepareRuns splits the memory limit of cfg between concurrency sorting goroutines and, if
+// any runs may have to be written, creates a temporary directory for them. If spill is true,
+// runs are written even without a memory limit. The caller must remove the directory unless
+// it is empty.
+//
+// Returns:
+//
+//	int64 - The memory budget of each sorting goroutine, or 0 for no limit
+//	string - The path of the temporary directory, or "" if it was not needed
+//	error - Any error encountered while creating the directory
+func prepareRuns(cfg runConfig, concurrency int, spill bool) (int64, string, error) {
+	var budget int64
+	if cfg.memoryLimit > 0 && concurrency > 0 {
+		budget = max(cfg.memoryLimit/int64(concurrency), 1)
 	}
-
-	// Merge the sorted files
-	if err := mergeAndWrite(inputFiles, outputFile, parser, formatter, cmp); err != nil {
-		return fmt.Errorf("failed to merge files: %w", err)
+	if budget == 0 && !cfg.preserveInputs && !spill {
+		return 0, "", nil
 	}
 
-	return nil
+	runDir, err := os.MkdirTemp(cfg.tempDir, "kwaymerger-")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	return budget, runDir, nil
 }
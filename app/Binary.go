@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Codec reads and writes values of type T as fixed-size binary records, which are decoded
+// straight from the bytes of the inputs and encoded straight into the output, without being
+// converted to strings. Decode must not retain b, which is reused for later records.
+type Codec[T any] struct {
+	Size   int                   // Size in bytes of each record
+	Decode func(b []byte) T      // Decodes the value of a record of Size bytes
+	Encode func(b []byte, val T) // Encodes val into a record of Size bytes
+}
+
+// Int32Codec returns a codec for int32 values stored in 4 bytes with the given byte order,
+// such as binary.LittleEndian or binary.BigEndian.
+func Int32Codec(order binary.ByteOrder) Codec[int32] {
+	return Codec[int32]{
+		Size:   4,
+		Decode: func(b []byte) int32 { return int32(order.Uint32(b)) },
+		Encode: func(b []byte, val int32) { order.PutUint32(b, uint32(val)) },
+	}
+}
+
+// Int64Codec returns a codec for int64 values stored in 8 bytes with the given byte order.
+func Int64Codec(order binary.ByteOrder) Codec[int64] {
+	return Codec[int64]{
+		Size:   8,
+		Decode: func(b []byte) int64 { return int64(order.Uint64(b)) },
+		Encode: func(b []byte, val int64) { order.PutUint64(b, uint64(val)) },
+	}
+}
+
+// Uint64Codec returns a codec for uint64 values stored in 8 bytes with the given byte order.
+func Uint64Codec(order binary.ByteOrder) Codec[uint64] {
+	return Codec[uint64]{
+		Size:   8,
+		Decode: order.Uint64,
+		Encode: order.PutUint64,
+	}
+}
+
+// Float64Codec returns a codec for float64 values stored as IEEE 754 binary64 in 8 bytes with
+// the given byte order.
+func Float64Codec(order binary.ByteOrder) Codec[float64] {
+	return Codec[float64]{
+		Size:   8,
+		Decode: func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) },
+		Encode: func(b []byte, val float64) { order.PutUint64(b, math.Float64bits(val)) },
+	}
+}
+
+// StructCodec returns a codec for values of type T laid out as encoding/binary lays them out
+// with the given byte order: the fields of structs in order, without padding, and arrays element
+// by element. T must have a fixed size, so it may only contain fixed-size numbers, bools, arrays
+// and structs of them. The layout is decoded and encoded with reflection, which is slower than
+// the codecs of single numbers.
+func StructCodec[T any](order binary.ByteOrder) (Codec[T], error) {
+	var zero T
+	size := binary.Size(zero)
+	if size <= 0 {
+		return Codec[T]{}, fmt.Errorf("type %T has no fixed binary size", zero)
+	}
+	return Codec[T]{
+		Size: size,
+		Decode: func(b []byte) T {
+			var val T
+			// Decoding cannot fail, since b holds size bytes and T has a fixed size
+			binary.Decode(b, order, &val)
+			return val
+		},
+		Encode: func(b []byte, val T) {
+			binary.Encode(b, order, val)
+		},
+	}, nil
+}
+
+// RunBinary is like Run, but reads and writes fixed-size binary records with codec instead of
+// parsing and formatting text. Inputs rewritten in place, sorted runs and the output file hold
+// the records back to back; options choosing how records are split or delimited are ignored.
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing unsorted records
+//	outputFile - Path to the output file where merged sorted records will be written
+//	codec - Codec decoding and encoding the records of type T
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the run
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func RunBinary[T any](inputFiles []string, outputFile string, codec Codec[T], cmp func(T, T) bool, opts ...Option) error {
+	return run(context.Background(), inputFiles, outputFile, nil, formatBinary[T], cmp, newBinaryConfig(codec, opts...))
+}
+
+// MergeBinary is like Merge, but reads and writes fixed-size binary records with codec instead
+// of parsing and formatting text. Options choosing how records are split or delimited are ignored.
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing sorted records
+//	outputFile - Path to the output file where merged sorted records will be written
+//	codec - Codec decoding and encoding the records of type T
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the merge
+//
+// Returns:
+//
+//	error - Any error encountered during the process
+func MergeBinary[T any](inputFiles []string, outputFile string, codec Codec[T], cmp func(T, T) bool, opts ...Option) error {
+	return merge(context.Background(), inputFiles, outputFile, nil, formatBinary[T], cmp, newBinaryConfig(codec, opts...))
+}
+
+// newBinaryConfig returns the settings of a run configured by opts that reads and writes
+// records with codec.
+func newBinaryConfig[T any](codec Codec[T], opts ...Option) runConfig {
+	cfg := newRunConfig(opts...)
+	size := codec.Size
+	cfg.codec = recordCodec[T]{
+		decode: codec.Decode,
+		append: func(b []byte, val T) []byte {
+			b = slices.Grow(b, size)[:len(b)+size]
+			codec.Encode(b[len(b)-size:], val)
+			return b
+		},
+	}
+	cfg.recordSize = size
+	cfg.split = scanFixed(codec.Size)
+	cfg.terminator = ""
+	cfg.delimiter = ""
+	cfg.resyncable = true
+	cfg.header = false
+	if !cfg.inputCompressionSet {
+		// A record may start with the magic bytes of a compression format
+		cfg.inputCompression = CompressionExtension
+	}
+	return cfg
+}
+
+// formatBinary formats binary values in error messages, since they have no text form.
+func formatBinary[T any](val T) string {
+	return fmt.Sprintf("%v", val)
+}
+
+// scanFixed returns a split function for records of size bytes. An input ending with a
+// partial record is an error.
+func scanFixed(size int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) >= size {
+			return size, data[:size], nil
+		}
+		if atEOF && len(data) > 0 {
+			return 0, nil, fmt.Errorf("input ends with a partial record of %d of %d bytes", len(data), size)
+		}
+		// Request more data
+		return 0, nil, nil
+	}
+}
+
+// recordCodec decodes and encodes the binary records of a run, of fixed size or framed.
+type recordCodec[T any] struct {
+	decode func(b []byte) T             // Decodes the value of a record, which must not keep b
+	append func(b []byte, val T) []byte // Appends the record of val to b
+}
+
+// valueWriter returns a function writing a value followed by terminator to a buffered writer,
+// encoded with the codec of cfg for binary records, or formatted with formatter otherwise. The
+// function returns the error of the last write; earlier errors are reported when the writer
+// is flushed.
+func valueWriter[T any](formatter FormatFunc[T], terminator string, cfg runConfig) func(*bufio.Writer, T) error {
+	if codec, ok := cfg.codec.(recordCodec[T]); ok {
+		return func(bw *bufio.Writer, val T) error {
+			// Encode into the free space of the buffer, which grows the record if it does not fit
+			_, err := bw.Write(codec.append(bw.AvailableBuffer(), val))
+			return err
+		}
+	}
+	return func(bw *bufio.Writer, val T) error {
+		bw.WriteString(formatter(val))
+		_, err := bw.WriteString(terminator)
+		return err
+	}
+}
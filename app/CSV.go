@@ -0,0 +1,138 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// CSVQuoting selects how quotes are read in the fields of CSV and TSV rows.
+type CSVQuoting int
+
+const (
+	// CSVQuotes reads fields starting with a quote as quoted fields, which may contain the field
+	// delimiter, newlines and quotes written as "". Quotes elsewhere are ordinary characters.
+	CSVQuotes CSVQuoting = iota
+	// CSVNoQuotes reads all quotes as ordinary characters, as in most TSV files. Fields cannot
+	// contain the field delimiter, and rows end at every newline.
+	CSVNoQuotes
+)
+
+// CSVRecord is a row of a CSV or TSV input together with its fields. The row is kept as it was
+// read, so that it is written back unchanged.
+type CSVRecord struct {
+	Row    string   // Row as read from the input, without its line terminator
+	Fields []string // Fields of the row
+}
+
+// ParseCSV returns a ParseFunc splitting CSV rows read with WithCSV into their fields, using comma
+// as the field delimiter, for example ',' for CSV or '\t' for TSV, and reading quotes as described
+// for quoting, which must match the one given to WithCSV.
+func ParseCSV(comma rune, quoting CSVQuoting) ParseFunc[CSVRecord] {
+	if quoting == CSVNoQuotes {
+		return func(row string) (CSVRecord, error) {
+			return CSVRecord{Row: row, Fields: strings.Split(row, string(comma))}, nil
+		}
+	}
+	return func(row string) (CSVRecord, error) {
+		r := csv.NewReader(strings.NewReader(row))
+		r.Comma = comma
+		r.FieldsPerRecord = -1
+		// Quotes in unquoted fields are ordinary characters, as scanCSV reads them
+		r.LazyQuotes = true
+		fields, err := r.Read()
+		if err != nil {
+			return CSVRecord{}, fmt.Errorf("failed to parse CSV row %q: %w", row, err)
+		}
+		return CSVRecord{Row: row, Fields: fields}, nil
+	}
+}
+
+// FormatCSV returns the original row of rec.
+func FormatCSV(rec CSVRecord) string {
+	return rec.Row
+}
+
+// CompareCSVColumns returns a comparator ordering CSV records by the fields of the given columns,
+// numbered from 0, compared as strings. Later columns break ties of earlier ones, and missing
+// fields compare as empty strings.
+func CompareCSVColumns(columns ...int) func(a, b CSVRecord) bool {
+	return func(a, b CSVRecord) bool {
+		for _, column := range columns {
+			x, y := csvField(a, column), csvField(b, column)
+			if x != y {
+				return x < y
+			}
+		}
+		return false
+	}
+}
+
+// csvField returns the field of rec in the given column, or "" if the row has no such field.
+func csvField(rec CSVRecord, column int) string {
+	if column < 0 || column >= len(rec.Fields) {
+		return ""
+	}
+	return rec.Fields[column]
+}
+
+// scanCSV returns a split function for CSV rows with the field delimiter comma and quoting. Rows
+// end at a newline outside of quoted fields, which start with a quote right at the start of a
+// field and end at a quote that is not doubled and is followed by the delimiter or the end of the
+// row, as encoding/csv reads them with LazyQuotes. A trailing carriage return is removed from
+// each row, and the last row does not need to end with a newline.
+func scanCSV(comma rune, quoting CSVQuoting) bufio.SplitFunc {
+	if quoting == CSVNoQuotes {
+		return bufio.ScanLines
+	}
+	delim := []byte(string(comma))
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		const (
+			fieldStart  = iota // At the start of a field
+			unquoted           // In an unquoted field
+			quoted             // In a quoted field
+			quoteQuoted        // After a quote in a quoted field, which ends it or is doubled
+		)
+		state := fieldStart
+		for i := 0; i < len(data); i++ {
+			b := data[i]
+			if b == '\n' && state != quoted {
+				return i + 1, dropCR(data[:i]), nil
+			}
+			if state != quoted && bytes.HasPrefix(data[i:], delim) {
+				i += len(delim) - 1
+				state = fieldStart
+				continue
+			}
+			switch {
+			case state == fieldStart && b == '"':
+				state = quoted
+			case state == fieldStart:
+				state = unquoted
+			case state == quoted && b == '"':
+				state = quoteQuoted
+			case state == quoteQuoted && b != '\r':
+				// A doubled quote, or a lone quote kept as an ordinary character
+				state = quoted
+			}
+		}
+		if atEOF {
+			return len(data), dropCR(data), nil
+		}
+		// Request more data
+		return 0, nil, nil
+	}
+}
+
+// dropCR drops a terminal carriage return from row.
+func dropCR(row []byte) []byte {
+	if len(row) > 0 && row[len(row)-1] == '\r' {
+		return row[:len(row)-1]
+	}
+	return row
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffSize is the number of leading bytes of an input examined to detect its compression.
+const sniffSize = 512
+
+// Compression is the compression format of input or output files.
+type Compression int
+
+const (
+	// CompressionAuto detects the compression of inputs from their file extension, or else from
+	// their first bytes, and chooses the compression of output files from their extension.
+	CompressionAuto Compression = iota
+	// CompressionNone reads and writes files as they are.
+	CompressionNone
+	// CompressionGzip reads and writes gzip files, usually named *.gz.
+	CompressionGzip
+	// CompressionZlib reads and writes zlib streams, usually named *.zz.
+	CompressionZlib
+	// CompressionBzip2 reads bzip2 files, usually named *.bz2. Output cannot be bzip2-compressed.
+	CompressionBzip2
+	// CompressionExtension detects the compression of input files from their extension only,
+	// and reads other inputs as they are. It is the default of binary and framed records, which
+	// may start with bytes that look like a compressed stream. For output files it is the same
+	// as CompressionAuto.
+	CompressionExtension
+)
+
+// String returns the name of the compression.
+func (c Compression) String() string {
+	switch c {
+	case CompressionAuto:
+		return "auto"
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZlib:
+		return "zlib"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionExtension:
+		return "extension"
+	default:
+		return "unknown"
+	}
+}
+
+// compressionByExtension returns the compression of the file named name according to its
+// extension, or CompressionAuto if the extension is not one of a compression format.
+func compressionByExtension(name string) Compression {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zz", ".zlib":
+		return CompressionZlib
+	case ".bz2":
+		return CompressionBzip2
+	default:
+		return CompressionAuto
+	}
+}
+
+// detectCompression returns the compression of the input named name, of which head holds the
+// first bytes, according to its extension or else its magic bytes.
+func detectCompression(name string, head []byte) Compression {
+	if c := compressionByExtension(name); c != CompressionAuto {
+		return c
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b, 0x08}):
+		return CompressionGzip
+	case len(head) >= 10 && bytes.HasPrefix(head, []byte("BZh")) && head[3] >= '1' && head[3] <= '9' &&
+		(bytes.HasPrefix(head[4:], []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) || bytes.HasPrefix(head[4:], []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90})):
+		// A block or the end of an empty stream follows the header
+		return CompressionBzip2
+	case isZlib(head):
+		return CompressionZlib
+	default:
+		return CompressionNone
+	}
+}
+
+// isZlib reports whether head starts a zlib stream. Since the two bytes of the zlib header
+// may start text as well, such as "x^", head must also decompress without error as far as
+// it goes, and completely with a valid checksum if it is shorter than sniffSize and thus
+// holds the whole input.
+func isZlib(head []byte) bool {
+	if len(head) < 2 || head[0]&0x0f != 8 || head[0]>>4 > 7 || head[1]&0x20 != 0 || (int(head[0])<<8|int(head[1]))%31 != 0 {
+		return false
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, zr)
+	return err == nil || len(head) == sniffSize && errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// decompress returns a reader of the decompressed contents of r, the input named name,
+// compressed with c, or detected as described for CompressionAuto and CompressionExtension,
+// and whether r is compressed.
+func decompress(name string, r io.Reader, c Compression) (io.Reader, bool, error) {
+	if c == CompressionExtension {
+		if c = compressionByExtension(name); c == CompressionAuto {
+			c = CompressionNone
+		}
+	}
+	if c == CompressionNone {
+		return r, false, nil
+	}
+	br := bufio.NewReaderSize(r, sniffSize)
+	if c == CompressionAuto {
+		head, err := br.Peek(sniffSize)
+		if err != nil && err != io.EOF {
+			return nil, false, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		c = detectCompression(name, head)
+	}
+
+	var dr io.Reader
+	var err error
+	switch c {
+	case CompressionNone:
+		return br, false, nil
+	case CompressionGzip:
+		dr, err = gzip.NewReader(br)
+	case CompressionZlib:
+		dr, err = zlib.NewReader(br)
+	case CompressionBzip2:
+		dr = bzip2.NewReader(br)
+	default:
+		return nil, false, fmt.Errorf("unknown compression %d of %s", c, name)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s header of %s: %w", c, name, err)
+	}
+	return dr, true, nil
+}
+
+// openInput opens the input file and returns the file, which the caller must close, a reader
+// of its contents decompressed according to cfg, and whether it is compressed.
+func openInput(file string, cfg runConfig) (*os.File, io.Reader, bool, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to open file %s: %w", file, err)
+	}
+	r, compressed, err := decompress("file "+file, fd, cfg.inputCompression)
+	if err != nil {
+		fd.Close()
+		return nil, nil, false, err
+	}
+	return fd, r, compressed, nil
+}
+
+// anyCompressed reports whether any of the input files is compressed according to cfg.
+func anyCompressed(inputFiles []string, cfg runConfig) (bool, error) {
+	if cfg.inputCompression == CompressionNone {
+		return false, nil
+	}
+	for _, file := range inputFiles {
+		fd, _, compressed, err := openInput(file, cfg)
+		if err != nil {
+			return false, err
+		}
+		fd.Close()
+		if compressed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nopWriteCloser is a writer whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// compressOutput returns a writer compressing the output file named name into w with the
+// output compression of cfg. The writer must be closed to complete the output, which does
+// not close w.
+func compressOutput(name string, w io.Writer, cfg runConfig) (io.WriteCloser, error) {
+	c := cfg.outputCompression
+	if c == CompressionAuto || c == CompressionExtension {
+		c = compressionByExtension(name)
+	}
+	switch c {
+	case CompressionAuto, CompressionNone:
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZlib:
+		return zlib.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("cannot write %s output file %s", c, name)
+	}
+}
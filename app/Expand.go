@@ -0,0 +1,171 @@
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InputExpansion configures how glob patterns and directories among the inputs of a run are
+// expanded into input files by ExpandInputs and WithInputExpansion.
+type InputExpansion struct {
+	Recursive bool     // Whether files in subdirectories of directory inputs are included
+	Include   []string // Patterns of the base names of expanded files to include, all files if empty
+	Exclude   []string // Patterns of the base names of expanded files and directories to exclude
+	Hidden    bool     // Whether expanded files and directories whose names start with a dot are included
+}
+
+// ExpandInputs expands glob patterns and directories among inputs into the input files they
+// stand for, in a deterministic order. Inputs are expanded in order, and each into files in
+// lexical order:
+//
+//   - A path containing any of the glob characters *, ? and [ is a pattern as described for
+//     filepath.Match, which must match at least one file or directory.
+//   - A directory stands for the regular files directly in it, or in the whole tree below it if
+//     exp.Recursive is true. Subdirectories are walked in lexical order as well.
+//   - Any other path is a file, which is kept as it is, even if it does not exist.
+//
+// Files and directories matched by patterns or found in directories are skipped if their names
+// start with a dot, unless exp.Hidden is true, or if they match any pattern of exp.Exclude. Files
+// are then kept only if they match a pattern of exp.Include, if any. Patterns are matched against
+// base names. A file listed more than once is kept at its first position only.
+func ExpandInputs(inputs []string, exp InputExpansion) ([]string, error) {
+	for _, patterns := range [][]string{exp.Include, exp.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if key := filepath.Clean(file); !seen[key] {
+			seen[key] = true
+			files = append(files, file)
+		}
+	}
+	for _, input := range inputs {
+		paths := []string{input}
+		if strings.ContainsAny(input, "*?[") {
+			matches, err := filepath.Glob(input)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", input, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("pattern %q matches no files", input)
+			}
+			paths = paths[:0]
+			for _, match := range matches {
+				if !exp.skip(filepath.Base(match)) {
+					paths = append(paths, match)
+				}
+			}
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil || !info.IsDir() {
+				// Files that cannot be read are reported when they are opened
+				if path == input || exp.include(filepath.Base(path)) {
+					add(path)
+				}
+				continue
+			}
+			dirFiles, err := exp.walk(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range dirFiles {
+				add(file)
+			}
+		}
+	}
+	return files, nil
+}
+
+// WithInputExpansion expands glob patterns and directories among the input files of Run, Merge
+// and the other entry points taking input files as described for ExpandInputs, before the
+// sort phase. By default input paths are used as they are.
+func WithInputExpansion(exp InputExpansion) Option {
+	return func(cfg *runConfig) {
+		cfg.expansion = &exp
+	}
+}
+
+// expandInputs returns the input files of a run with settings cfg, expanded if cfg asks for it.
+func expandInputs(inputFiles []string, cfg runConfig) ([]string, error) {
+	if cfg.expansion == nil {
+		return inputFiles, nil
+	}
+	files, err := ExpandInputs(inputFiles, *cfg.expansion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand inputs: %w", err)
+	}
+	return files, nil
+}
+
+// walk returns the regular files in dir, and below it if exp.Recursive is true, that are not
+// skipped and are included, in lexical order. Symbolic links to regular files are included,
+// while those to directories are not walked.
+func (exp InputExpansion) walk(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() {
+			if !exp.Recursive || exp.skip(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if exp.skip(d.Name()) || !exp.include(d.Name()) {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// Links are followed to files only, so that walks never loop
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// skip reports whether the file or directory with the given base name is skipped because it
+// is hidden or excluded.
+func (exp InputExpansion) skip(name string) bool {
+	if !exp.Hidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	return matchAny(exp.Exclude, name)
+}
+
+// include reports whether the file with the given base name is included.
+func (exp InputExpansion) include(name string) bool {
+	return len(exp.Include) == 0 || matchAny(exp.Include, name)
+}
+
+// matchAny reports whether name matches any of the patterns, which are known to be valid.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"os"
+)
+
+// fallbackMaxFanIn is the default maximum fan-in if the limit on open files is unknown.
+const fallbackMaxFanIn = 1024
+
+// MergePass describes one pass of a merge. Every pass but the last merges groups of at most
+// the maximum fan-in of consecutive files into intermediate runs; the last pass merges the
+// remaining files into the output.
+type MergePass struct {
+	Inputs  int // Number of sorted files merged by the pass
+	Outputs int // Number of files written by the pass, 1 for the last pass
+}
+
+// planMerge returns the passes needed to merge n sorted files opening at most fanIn
+// files at the same time.
+func planMerge(n, fanIn int) []MergePass {
+	var plan []MergePass
+	for n > fanIn {
+		outputs := (n + fanIn - 1) / fanIn
+		plan = append(plan, MergePass{Inputs: n, Outputs: outputs})
+		n = outputs
+	}
+	return append(plan, MergePass{Inputs: n, Outputs: 1})
+}
+
+// mergeFilesSeq returns an iterator over the merged values of the sorted input files, as
+// described for mergeSeq. If there are more files than the maximum fan-in of cfg, they are
+// first reduced by mergePasses. Intermediate runs are removed when the iteration ends. If header
+// is not nil, it receives the header of the first file that has one before any value is yielded.
+func mergeFilesSeq[T any](ctx context.Context, inputFiles []string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, header *headerRow, cfg runConfig) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		files, runDir, err := mergePasses(ctx, inputFiles, parser, formatter, cmp, validate, cfg)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer removeRuns(runDir)
+		if runDir != "" {
+			// The input files were validated and decompressed by the first pass
+			validate = false
+			cfg.inputCompression = CompressionNone
+		}
+
+		sources, err := openFiles(files, parser, cfg)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		if header != nil {
+			if *header, err = firstHeader(sources); err != nil {
+				closeSources(sources)
+				yield(zero, err)
+				return
+			}
+		}
+		for val, err := range mergeSeq(ctx, sources, formatter, cmp, validate, cfg) {
+			if !yield(val, err) {
+				return
+			}
+		}
+	}
+}
+
+// mergePasses merges groups of at most the maximum fan-in of cfg consecutive input files into
+// intermediate runs, pass by pass, until no more files than the fan-in remain. Since groups
+// are consecutive and keep their order, stable merges stay stable. Only the first pass reads
+// the input files, so only it validates and decompresses them. If cfg.plan is not nil, it receives all passes
+// of the merge, including the final one.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation aborts the passes
+//	inputFiles - Slice of paths to the input files containing sorted values
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	validate - Whether to check that every input file is sorted according to cmp
+//	cfg - Settings of the run
+//
+// Returns:
+//
+//	[]string - The paths of the files to merge in the final pass, in order
+//	string - The path of the temporary directory of intermediate runs, or "" if no pass was
+//	         needed; the caller must remove it with removeRuns
+//	error - Any error encountered while merging; the temporary directory is already removed
+func mergePasses[T any](ctx context.Context, inputFiles []string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) ([]string, string, error) {
+	cfg.progress.startPhase(PhaseMerge)
+	fanIn := maxFanIn(cfg)
+	plan := planMerge(len(inputFiles), fanIn)
+	if cfg.plan != nil {
+		*cfg.plan = plan
+	}
+	if len(plan) == 1 {
+		return inputFiles, "", nil
+	}
+
+	// Prepare a temporary directory for the intermediate runs
+	runDir, err := os.MkdirTemp(cfg.tempDir, "kwaymerger-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	files := inputFiles
+	for pass := range plan[:len(plan)-1] {
+		outputs := make([]string, 0, plan[pass].Outputs)
+		for start := 0; start < len(files); start += fanIn {
+			group := files[start:min(start+fanIn, len(files))]
+			run, err := mergeRun(ctx, group, runDir, parser, formatter, cmp, validate && pass == 0, cfg)
+			if err != nil {
+				removeRuns(runDir)
+				return nil, "", fmt.Errorf("failed to merge pass %d: %w", pass+1, err)
+			}
+			outputs = append(outputs, run)
+		}
+
+		// Remove the intermediate runs of the previous pass, never the input files
+		if pass > 0 {
+			for _, file := range files {
+				os.Remove(file)
+			}
+		}
+		files = outputs
+		// Intermediate runs are never compressed
+		cfg.inputCompression = CompressionNone
+	}
+
+	return files, runDir, nil
+}
+
+// maxFanIn returns the maximum number of files merged at the same time according to cfg.
+func maxFanIn(cfg runConfig) int {
+	if cfg.maxFanIn == 0 {
+		return defaultMaxFanIn()
+	}
+	return cfg.maxFanIn
+}
+
+// mergeRun merges the sorted files into a new run file in dir, returning the path of the run.
+func mergeRun[T any](ctx context.Context, files []string, dir string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) (run string, err error) {
+	sources, err := openFiles(files, parser, cfg)
+	if err != nil {
+		return "", err
+	}
+	// The run keeps the header of the first file of its group, as the final pass expects
+	header, err := firstHeader(sources)
+	if err != nil {
+		closeSources(sources)
+		return "", err
+	}
+
+	// Create a new run file in the temporary directory
+	fd, err := os.CreateTemp(dir, "run-*.txt")
+	if err != nil {
+		closeSources(sources)
+		return "", fmt.Errorf("failed to create run file in %s: %w", dir, err)
+	}
+	// Ensure file is closed when function exits
+	defer func() {
+		closeErr := fd.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close run file %s: %w", fd.Name(), closeErr)
+		}
+	}()
+
+	// Intermediate runs are plain merges, duplicates are only dropped or reduced in the final pass
+	seq := kwaySeq(ctx, sources, formatter, cmp, validate, cfg)
+	if err = writeSeq(fd, seq, formatter, cfg.terminator, &header, cfg); err != nil {
+		return "", fmt.Errorf("failed to write run file %s: %w", fd.Name(), err)
+	}
+
+	if cfg.sync {
+		// Sync file to ensure data is written to disk
+		if err = fd.Sync(); err != nil {
+			return "", fmt.Errorf("failed to sync run file %s: %w", fd.Name(), err)
+		}
+	}
+
+	return fd.Name(), nil
+}
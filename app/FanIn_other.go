@@ -0,0 +1,9 @@
+//go:build !unix
+
+package app
+
+// defaultMaxFanIn returns the fan-in used on systems without a limit on open files
+// that could be queried.
+func defaultMaxFanIn() int {
+	return fallbackMaxFanIn
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package app
+
+import "syscall"
+
+// defaultMaxFanIn returns half of the soft limit on open files of the process, so that
+// the rest of the process keeps enough file descriptors while merging.
+func defaultMaxFanIn() int {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return fallbackMaxFanIn
+	}
+	return int(max(min(rlim.Cur/2, 1<<20), 2))
+}
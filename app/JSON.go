@@ -0,0 +1,176 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONKeyType is the type of the sort key of JSON records, which determines how keys compare.
+type JSONKeyType int
+
+const (
+	// JSONNumber compares keys as JSON numbers. Integers in the range of int64 compare exactly,
+	// other numbers as float64.
+	JSONNumber JSONKeyType = iota
+	// JSONString compares keys as JSON strings, byte by byte.
+	JSONString
+	// JSONTime compares keys as JSON strings holding RFC 3339 timestamps, by the instant they denote.
+	JSONTime
+)
+
+// JSONRecord is a line of a JSON Lines input together with its sort key. The line is kept as it
+// was read, so that it is written back unchanged.
+type JSONRecord struct {
+	Line string // Line as read from the input, without its line terminator
+	Key  any    // Sort key, an int64 or float64, string or time.Time by key type, or nil if missing or null
+}
+
+// ParseJSON returns a ParseFunc reading lines of JSON Lines inputs, read with WithLines, as JSON
+// objects and extracting their sort key of type keyType at path, a dotted path of field names such
+// as "meta.ts". Records without the field, or in which it is null, have a nil key. Lines that are not
+// JSON objects, and keys of another type, are parse errors.
+func ParseJSON(path string, keyType JSONKeyType) ParseFunc[JSONRecord] {
+	fields := strings.Split(path, ".")
+	return func(line string) (JSONRecord, error) {
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			return JSONRecord{}, fmt.Errorf("failed to parse JSON line %q: %w", line, err)
+		}
+		if _, err := dec.Token(); obj == nil || err != io.EOF {
+			return JSONRecord{}, fmt.Errorf("failed to parse JSON line %q: not a single JSON object", line)
+		}
+
+		rec := JSONRecord{Line: line}
+		val, ok := jsonField(obj, fields)
+		if !ok || val == nil {
+			return rec, nil
+		}
+		key, err := jsonKey(val, keyType)
+		if err != nil {
+			return JSONRecord{}, fmt.Errorf("failed to parse key %s of JSON line %q: %w", path, line, err)
+		}
+		rec.Key = key
+		return rec, nil
+	}
+}
+
+// FormatJSON returns the original line of rec.
+func FormatJSON(rec JSONRecord) string {
+	return rec.Line
+}
+
+// CompareJSON orders JSON records by their keys, which must be of the same key type. Records
+// with a nil key come first.
+func CompareJSON(a, b JSONRecord) bool {
+	switch x := a.Key.(type) {
+	case nil:
+		return b.Key != nil
+	case int64:
+		switch y := b.Key.(type) {
+		case int64:
+			return x < y
+		case float64:
+			return lessIntFloat(x, y)
+		}
+		return false
+	case float64:
+		switch y := b.Key.(type) {
+		case int64:
+			return lessFloatInt(x, y)
+		case float64:
+			return x < y
+		}
+		return false
+	case string:
+		y, ok := b.Key.(string)
+		return ok && x < y
+	case time.Time:
+		y, ok := b.Key.(time.Time)
+		return ok && x.Before(y)
+	default:
+		return false
+	}
+}
+
+// jsonField returns the value at the path of fields in obj, and whether it exists.
+func jsonField(obj map[string]any, fields []string) (any, bool) {
+	var val any = obj
+	for _, field := range fields {
+		m, ok := val.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if val, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// jsonKey converts val, decoded with json.Decoder.UseNumber, to a key of type keyType.
+func jsonKey(val any, keyType JSONKeyType) (any, error) {
+	switch keyType {
+	case JSONNumber:
+		n, ok := val.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number", val)
+		}
+		// Integers are kept exact, float64 cannot hold all those above 2^53
+		if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	case JSONString:
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", val)
+		}
+		return s, nil
+	case JSONTime:
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", val)
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return nil, fmt.Errorf("unknown key type %d", keyType)
+	}
+}
+
+// lessIntFloat reports whether x is less than y, comparing exactly.
+func lessIntFloat(x int64, y float64) bool {
+	switch {
+	case y >= math.MaxInt64:
+		// math.MaxInt64 rounds up to 2^63, which no int64 reaches
+		return true
+	case y < math.MinInt64:
+		return false
+	}
+	t := math.Trunc(y)
+	if i := int64(t); x != i {
+		return x < i
+	}
+	return y > t
+}
+
+// lessFloatInt reports whether x is less than y, comparing exactly.
+func lessFloatInt(x float64, y int64) bool {
+	switch {
+	case x >= math.MaxInt64:
+		return false
+	case x < math.MinInt64:
+		return true
+	}
+	t := math.Trunc(x)
+	if i := int64(t); i != y {
+		return i < y
+	}
+	return x < t
+}
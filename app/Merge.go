@@ -0,0 +1,419 @@
+package app
+
+import (
+	myHeap "KWayMerger/heap"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotSorted is wrapped by the errors of merges whose inputs are checked and found not to be
+// sorted, such as those of Merge and MergeStreams.
+var ErrNotSorted = errors.New("not sorted")
+
+// mergeAndWrite merges values of type T from multiple sorted input files into a single
+// sorted output file using a min-heap. It reads the smallest available value
+// from each input file, adds it to the heap, and then extracts the minimum
+// value to write to the output file, compressed according to cfg. If cfg.parallelMerge is
+// greater than 1, key ranges are merged at the same time by mergeParallel. If the merge fails
+// or ctx is canceled, the partially written output file is removed.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation aborts the merge
+//	inputFiles - Slice of paths to the input files containing sorted values
+//	outputFile - Path to the output file where merged sorted values will be written
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	validate - Whether to check that every input file is sorted according to cmp
+//	cfg - Settings of the run
+//
+// Returns:
+//
+//	error - Any error encountered during merging or writing
+func mergeAndWrite[T any](ctx context.Context, inputFiles []string, outputFile string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) (err error) {
+	defer cfg.stats.timeMerge(time.Now())
+
+	// Open output file for writing
+	fd, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, cfg.fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open output file %s: %w", outputFile, err)
+	}
+	// Ensure output file is closed when function exits, and removed if it is incomplete
+	defer func() {
+		closeErr := fd.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close output file %s: %w", outputFile, closeErr)
+		}
+		if err != nil {
+			os.Remove(outputFile)
+		}
+	}()
+	w, err := compressOutput(outputFile, fd, cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.parallelMerge > 1 {
+		err = mergeParallel(ctx, inputFiles, w, parser, formatter, cmp, validate, cfg)
+	} else {
+		err = mergeFiles(ctx, inputFiles, w, parser, formatter, cmp, validate, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	// Complete the compressed stream, if any
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("failed to write output file %s: %w", outputFile, err)
+	}
+
+	// Sync output file to ensure data is written to disk
+	if cfg.sync {
+		err = fd.Sync()
+		if err != nil {
+			return fmt.Errorf("failed to sync output file %s: %w", outputFile, err)
+		}
+	}
+
+	return nil
+}
+
+// mergeFiles merges the values of the sorted input files into w, each followed by the
+// delimiter of cfg, in as many passes as the maximum fan-in of cfg requires. The header of the
+// first file that has one, if any, is written first.
+func mergeFiles[T any](ctx context.Context, inputFiles []string, w io.Writer, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) error {
+	var header headerRow
+	return writeSeq(w, mergeFilesSeq(ctx, inputFiles, parser, formatter, cmp, validate, &header, cfg), formatter, cfg.delimiter, &header, cfg)
+}
+
+// openFiles opens the given files as sources, decompressed according to cfg. If any file
+// cannot be opened, the files opened so far are closed again.
+func openFiles[T any](inputFiles []string, parser ParseFunc[T], cfg runConfig) ([]*source[T], error) {
+	sources := make([]*source[T], 0, len(inputFiles))
+	for _, file := range inputFiles {
+		fd, r, _, err := openInput(file, cfg)
+		if err != nil {
+			closeSources(sources)
+			return nil, err
+		}
+		sources = append(sources, newSource("file "+file, r, fd, parser, cfg))
+	}
+	return sources, nil
+}
+
+// closeSources closes all sources, ignoring errors. It is used for cleanup after
+// another error or when a merge is stopped early.
+func closeSources[T any](sources []*source[T]) {
+	for _, src := range sources {
+		src.close()
+	}
+}
+
+// mergeSources merges the values of the sorted sources into w, each followed by the
+// delimiter of cfg. The header of the first source that has one, if any, is written first.
+// All sources are closed before returning.
+func mergeSources[T any](ctx context.Context, sources []*source[T], w io.Writer, formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) error {
+	header, err := firstHeader(sources)
+	if err != nil {
+		closeSources(sources)
+		return err
+	}
+	return writeSeq(w, mergeSeq(ctx, sources, formatter, cmp, validate, cfg), formatter, cfg.delimiter, &header, cfg)
+}
+
+// writeSeq writes the values of seq to w, each encoded or formatted according to cfg and followed
+// by delimiter, through a buffer of the write buffer size of cfg that is flushed before returning.
+// If header is not nil and holds a header, its text is written first, once the first value is
+// merged or the merge ends, since seq may read the header together with its first value. It
+// stops at the first error of seq.
+func writeSeq[T any](w io.Writer, seq iter.Seq2[T, error], formatter FormatFunc[T], delimiter string, header *headerRow, cfg runConfig) error {
+	bw := bufio.NewWriterSize(w, cfg.writeBufferSize)
+	write := valueWriter(formatter, delimiter, cfg)
+	for val, err := range seq {
+		if err != nil {
+			return err
+		}
+		if header != nil {
+			writeHeader(bw, header, delimiter)
+			header = nil
+		}
+		// Write the smallest value to output
+		if err = write(bw, val); err != nil {
+			return fmt.Errorf("failed to write merged value: %w", err)
+		}
+	}
+
+	if header != nil {
+		writeHeader(bw, header, delimiter)
+	}
+
+	// Flush buffered values, the error of any earlier write is reported here as well
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write merged value: %w", err)
+	}
+	return nil
+}
+
+// writeHeader writes the text of header followed by delimiter to bw if a header was read.
+// Errors are reported when bw is flushed.
+func writeHeader(bw *bufio.Writer, header *headerRow, delimiter string) {
+	if text, ok := header.get(); ok {
+		bw.WriteString(text)
+		bw.WriteString(delimiter)
+	}
+}
+
+// mergeSeq returns an iterator over the merged values of the sorted sources using a min-heap.
+// Each source is closed as soon as it is exhausted, and the remaining sources are closed
+// when the iteration ends, whether it completes, fails, or is stopped early. An error ends
+// the iteration; it is yielded together with the zero value of T. Canceling ctx ends the
+// iteration with the error of ctx. If cfg.stable is true, values that compare equal are
+// yielded in the order of their sources. If cfg.unique is true, values equal to the
+// previously yielded value are dropped, and if cfg.reduce is set, each group of values
+// that compare equal is reduced to one value. If cfg.progress is set, the number of values
+// read from the sources is reported to it, and if cfg.stats is set, the number of values
+// yielded is added to it. The sources can only be iterated once.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation aborts the merge
+//	sources - Sources of sorted values, in input order
+//	formatter - Function to format values of type T into strings for error messages
+//	cmp - Comparator function for ordering values of type T
+//	validate - Whether to check that every source is sorted according to cmp
+//	cfg - Settings of the run
+//
+// Returns:
+//
+//	iter.Seq2[T, error] - Iterator over the merged values
+func mergeSeq[T any](ctx context.Context, sources []*source[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		// Resolve the functions dropping duplicates and reducing groups, if any
+		equal, err := uniqueEqual(cfg, cmp)
+		var reduce ReduceFunc[T]
+		if err == nil {
+			reduce, err = reduceFunc[T](cfg)
+		}
+		if err != nil {
+			var zero T
+			closeSources(sources)
+			yield(zero, err)
+			return
+		}
+
+		cfg.progress.startPhase(PhaseMerge)
+		seq := kwaySeq(ctx, sources, formatter, cmp, validate, cfg)
+		if cfg.progress != nil {
+			seq = progressSeq(seq, cfg.progress)
+		}
+		if equal != nil {
+			seq = uniqueSeq(seq, equal, cfg.dropped)
+		}
+		if reduce != nil {
+			seq = reduceSeq(seq, cmp, reduce)
+		}
+		if cfg.stats != nil {
+			seq = statsSeq(seq, cfg.stats)
+		}
+		for val, err := range seq {
+			if !yield(val, err) {
+				return
+			}
+		}
+	}
+}
+
+// kwaySeq returns an iterator over the merged values of the sorted sources using the merge
+// engine of cfg, as described for mergeSeq, without dropping or reducing any values.
+func kwaySeq[T any](ctx context.Context, sources []*source[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		// Close all remaining sources on error or early exit
+		defer closeSources(sources)
+
+		var zero T
+		if err := ctx.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		// Initialize the queue with the provided comparator
+		queue := newMergeQueue(len(sources), cmp, cfg)
+
+		// Read the first value of each source and add it to the queue
+		for i, src := range sources {
+			val, ok, err := src.next()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !ok {
+				// Empty sources do not take part in the merge
+				if err = src.close(); err != nil {
+					yield(zero, err)
+					return
+				}
+				continue
+			}
+			queue.PushNode(myHeap.Node[T]{Val: val, Index: i})
+		}
+
+		// Merge process: extract minimum value from the queue and hand it to the caller
+		for merged := 1; !queue.Empty(); merged++ {
+			if merged%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					yield(zero, err)
+					return
+				}
+			}
+			node := queue.PopNode()
+			if !yield(node.Val, nil) {
+				return
+			}
+
+			// Read next value from the same source if available
+			src := sources[node.Index]
+			val, ok, err := src.next()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !ok {
+				// Source is exhausted, close it
+				if err = src.close(); err != nil {
+					yield(zero, err)
+					return
+				}
+				continue
+			}
+
+			// Values must never decrease within a source
+			if validate && cmp(val, node.Val) {
+				yield(zero, fmt.Errorf("%s is %w: record %d (%s) is less than record %d (%s)",
+					src.name, ErrNotSorted, src.record, formatter(val), src.record-1, formatter(node.Val)))
+				return
+			}
+			node.Val = val
+			queue.PushNode(node) // Reinsert node with new value
+		}
+	}
+}
+
+// mergeQueue is the priority queue holding the current value of each source during a merge.
+// It is implemented by myHeap.Heap and myHeap.LoserTree.
+type mergeQueue[T any] interface {
+	PushNode(node myHeap.Node[T])
+	PopNode() myHeap.Node[T]
+	Empty() bool
+}
+
+// newMergeQueue returns the queue of the merge engine of cfg for k sources. If cfg.stable
+// is true, ties are broken by the index of the source.
+func newMergeQueue[T any](k int, cmp func(T, T) bool, cfg runConfig) mergeQueue[T] {
+	switch {
+	case cfg.engine == EngineLoserTree && cfg.stable:
+		return myHeap.NewStableLoserTree(k, cmp)
+	case cfg.engine == EngineLoserTree:
+		return myHeap.NewLoserTree(k, cmp)
+	case cfg.stable:
+		return myHeap.NewStableHeap(k, cmp)
+	default:
+		return myHeap.NewHeap(k, cmp)
+	}
+}
+
+// uniqueSeq returns an iterator over the values of seq that drops every value equal to
+// the previously yielded value. If dropped is not nil, the number of dropped values is
+// stored in it when the iteration ends.
+func uniqueSeq[T any](seq iter.Seq2[T, error], equal func(T, T) bool, dropped *int64) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var last T
+		var hasLast bool
+		var count int64
+		if dropped != nil {
+			// Report the number of dropped duplicates however the iteration ends
+			defer func() { atomic.StoreInt64(dropped, count) }()
+		}
+
+		for val, err := range seq {
+			if err == nil && hasLast && equal(last, val) {
+				// Drop duplicates of the previously yielded value
+				count++
+				continue
+			}
+			if !yield(val, err) {
+				return
+			}
+			last, hasLast = val, true
+		}
+	}
+}
+
+// reduceSeq returns an iterator over the values of seq in which each group of consecutive
+// values that compare equal according to cmp is replaced by the result of reduce.
+func reduceSeq[T any](seq iter.Seq2[T, error], cmp func(T, T) bool, reduce ReduceFunc[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		// The group buffer is reused, reduce must not retain it
+		var group []T
+		for val, err := range seq {
+			if err != nil {
+				yield(val, err)
+				return
+			}
+			// Values never decrease, so a value starts a new group if it is greater than the group
+			if len(group) > 0 && cmp(group[0], val) {
+				if !yield(reduce(group), nil) {
+					return
+				}
+				clear(group)
+				group = group[:0]
+			}
+			group = append(group, val)
+		}
+		if len(group) > 0 {
+			yield(reduce(group), nil)
+		}
+	}
+}
+
+// uniqueEqual returns the function reporting whether a merged value equals its predecessor
+// according to cfg, or nil if duplicates are kept.
+func uniqueEqual[T any](cfg runConfig, cmp func(T, T) bool) (func(T, T) bool, error) {
+	if !cfg.unique {
+		return nil, nil
+	}
+	if cfg.equal == nil {
+		// Merged values never decrease, so a value equals its predecessor unless it is greater
+		return func(prev, val T) bool {
+			return !cmp(prev, val)
+		}, nil
+	}
+
+	equal, ok := cfg.equal.(func(T, T) bool)
+	if !ok {
+		var zero T
+		return nil, fmt.Errorf("equality function of type %T cannot compare values of type %T", cfg.equal, zero)
+	}
+	return equal, nil
+}
+
+// reduceFunc returns the function reducing groups of equal values according to cfg,
+// or nil if values are not reduced.
+func reduceFunc[T any](cfg runConfig) (ReduceFunc[T], error) {
+	if cfg.reduce == nil {
+		return nil, nil
+	}
+
+	reduce, ok := cfg.reduce.(ReduceFunc[T])
+	if !ok {
+		var zero T
+		return nil, fmt.Errorf("reduce function of type %T cannot reduce values of type %T", cfg.reduce, zero)
+	}
+	return reduce, nil
+}
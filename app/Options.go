@@ -0,0 +1,380 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+)
+
+// defaultReadBufferSize is the default initial size in bytes of the buffer used for reading each input.
+const defaultReadBufferSize = 4 << 10
+
+// defaultWriteBufferSize is the default size in bytes of the buffer used for writing files.
+const defaultWriteBufferSize = 64 << 10
+
+// runConfig holds the settings shared by the sort and merge phases of a run.
+type runConfig struct {
+	concurrency         int             // Maximum number of inputs to sort at the same time
+	memoryLimit         int64           // Approximate number of bytes of values to hold in memory, 0 for no limit
+	tempDir             string          // Directory in which to create temporary files, "" for the default
+	preserveInputs      bool            // Whether input files must never be rewritten
+	readBufferSize      int             // Initial size of the buffer used to read each input, 0 for the default
+	maxRecordSize       int             // Maximum size of a record including its terminator, 0 for the default, negative for no limit
+	writeBufferSize     int             // Size of the buffer used to write the output, rewritten inputs and runs
+	split               bufio.SplitFunc // Splits inputs into records, nil for whitespace-separated words
+	terminator          string          // String written after each record of rewritten inputs and runs
+	resyncable          bool            // Whether record boundaries are found when reading from any offset, as parallel merges require
+	header              bool            // Whether the first record of each input is a header
+	codec               any             // recordCodec[T] of binary records, used instead of the parser and formatter, nil for text records
+	recordSize          int             // Size in bytes of binary records, 0 if records vary in size
+	inputCompression    Compression     // Compression of the input files and readers
+	inputCompressionSet bool            // Whether inputCompression was set by WithInputCompression
+	outputCompression   Compression     // Compression of the output file
+	expansion           *InputExpansion // Expands the input files of a run, nil to use them as they are
+	delimiter           string          // String written after each merged value
+	fileMode            os.FileMode     // Permissions of the output file if it is created
+	sync                bool            // Whether written files are synced to disk before they are closed
+	stable              bool            // Whether values that compare equal keep their input order
+	unique              bool            // Whether duplicates of the previously merged value are dropped
+	equal               any             // Function of type func(T, T) bool detecting duplicates, nil to use the comparator
+	dropped             *int64          // Receives the number of dropped duplicates, may be nil
+	reduce              any             // ReduceFunc[T] combining groups of equal values, nil to keep all values
+	maxFanIn            int             // Maximum number of files merged at the same time, 0 for the default
+	plan                *[]MergePass    // Receives the passes of the merge, may be nil
+	engine              MergeEngine     // Priority queue used to merge the sorted files
+	parallelMerge       int             // Maximum number of key ranges merged at the same time, 0 or 1 for a serial merge
+	progress            *progress       // Receives the progress events of the run, may be nil
+	stats               *Stats          // Receives the statistics of the run, may be nil
+}
+
+// MergeEngine selects the priority queue that picks the next value during a merge.
+type MergeEngine int
+
+const (
+	// EngineHeap merges with a binary min-heap based on container/heap. It is the default.
+	EngineHeap MergeEngine = iota
+	// EngineLoserTree merges with a loser tree, which needs about log K comparisons per
+	// value instead of about 2·log K and does not allocate, K being the number of merged files.
+	EngineLoserTree
+)
+
+// Option configures a run. Options are accepted by all entry points of the package;
+// an option that does not apply to an entry point, such as WithPreserveInputs for Merge,
+// is ignored.
+type Option func(*runConfig)
+
+// newRunConfig returns the default settings modified by opts.
+func newRunConfig(opts ...Option) runConfig {
+	cfg := runConfig{
+		concurrency:       runtime.NumCPU(),
+		terminator:        "\n",
+		resyncable:        true,
+		delimiter:         "\n",
+		writeBufferSize:   defaultWriteBufferSize,
+		fileMode:          0644,
+		sync:              true,
+		outputCompression: CompressionNone,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithConcurrency sets the maximum number of input files sorted at the same time.
+// Values less than 1 are treated as 1. By default as many files are sorted at the
+// same time as there are CPUs.
+func WithConcurrency(n int) Option {
+	return func(cfg *runConfig) {
+		cfg.concurrency = max(n, 1)
+	}
+}
+
+// WithMemoryLimit bounds the memory used by the sort phase to about bytes of values,
+// shared between the concurrent sorting goroutines. An input whose values do not fit
+// into its share is left unmodified and split into sorted runs in the temporary
+// directory instead. By default, or if bytes is 0, there is no limit.
+func WithMemoryLimit(bytes int64) Option {
+	return func(cfg *runConfig) {
+		cfg.memoryLimit = bytes
+	}
+}
+
+// WithTempDir sets the directory under which the temporary directory of sorted runs is
+// created. By default, or if dir is "", the default temporary directory is used.
+func WithTempDir(dir string) Option {
+	return func(cfg *runConfig) {
+		cfg.tempDir = dir
+	}
+}
+
+// WithPreserveInputs controls whether the input files are treated as read-only. If
+// preserve is true, every input is sorted into runs in the temporary directory instead
+// of being rewritten in place, like RunReadOnly does.
+func WithPreserveInputs(preserve bool) Option {
+	return func(cfg *runConfig) {
+		cfg.preserveInputs = preserve
+	}
+}
+
+// WithReadBufferSize sets the initial size in bytes of the buffer used to read each input.
+// Larger buffers mean fewer reads, which helps with slow or remote inputs. By default, or
+// if size is 0, a 4 KiB buffer is used.
+func WithReadBufferSize(size int) Option {
+	return func(cfg *runConfig) {
+		cfg.readBufferSize = size
+	}
+}
+
+// UnlimitedRecordSize can be passed to WithMaxRecordSize to read records of any size.
+const UnlimitedRecordSize = -1
+
+// WithMaxRecordSize sets the maximum size in bytes of a record, including its terminator, read
+// from the inputs by the sort and merge phases. Each record is held in memory while it is read,
+// so the limit protects against inputs without terminators. A larger record fails the run with
+// an error naming the input and the offset of the record. With UnlimitedRecordSize, or any
+// negative size, records of any size are read. By default, or if size is 0, records are limited
+// to 64 KiB. The limit is never less than the read buffer size.
+func WithMaxRecordSize(size int) Option {
+	return func(cfg *runConfig) {
+		cfg.maxRecordSize = size
+	}
+}
+
+// WithWriteBufferSize sets the size in bytes of the buffer through which the output, rewritten
+// input files and sorted runs are written, so that values are written in few large writes
+// instead of one write per value. By default, or if size is 0, a 64 KiB buffer is used.
+func WithWriteBufferSize(size int) Option {
+	return func(cfg *runConfig) {
+		if size <= 0 {
+			size = defaultWriteBufferSize
+		}
+		cfg.writeBufferSize = size
+	}
+}
+
+// WithLines reads every line of the inputs as one record, so that records may contain spaces,
+// like log lines or names. A trailing carriage return is removed from each line, and the last
+// line does not need to end with a newline. Merged records are written one per line.
+func WithLines() Option {
+	return WithSplitFunc(bufio.ScanLines, "\n")
+}
+
+// WithRecordDelimiter reads the inputs as records terminated by delim, such as the NUL bytes
+// written by find -print0 for WithRecordDelimiter(0). The last record does not need to be
+// terminated. Merged records are written followed by delim, unless WithDelimiter is given
+// after this option.
+func WithRecordDelimiter(delim byte) Option {
+	return WithSplitFunc(scanDelimited(delim), string([]byte{delim}))
+}
+
+// WithSplitFunc reads the inputs as the records returned by split instead of whitespace-separated
+// words. terminator is written after each record of rewritten input files and sorted runs, which
+// are read back with split, so split must end a record at terminator and records must not contain
+// it. Merged records are written followed by terminator, unless WithDelimiter is given after this
+// option. WithParallelMerge requires split to find the next record when reading from any offset.
+func WithSplitFunc(split bufio.SplitFunc, terminator string) Option {
+	return func(cfg *runConfig) {
+		cfg.split = split
+		cfg.terminator = terminator
+		cfg.delimiter = terminator
+		cfg.resyncable = true
+	}
+}
+
+// WithCSV reads the inputs as rows of CSV or TSV files with the field delimiter comma, which end
+// at newlines outside of quoted fields, so that quoted fields may contain newlines. Quotes are
+// read as described for quoting; with CSVNoQuotes rows end at every newline. A trailing carriage
+// return is removed from each row. Rows are read as they are, to be split into fields by the
+// parser, for example the one returned by ParseCSV with the same comma and quoting, and are
+// written one per line. Merges of rows that may hold quoted fields are never parallel.
+func WithCSV(comma rune, quoting CSVQuoting) Option {
+	return func(cfg *runConfig) {
+		WithSplitFunc(scanCSV(comma, quoting), "\n")(cfg)
+		// A quoted field may contain newlines, so rows cannot be found from any offset
+		cfg.resyncable = quoting == CSVNoQuotes
+	}
+}
+
+// WithHeader treats the first record of each input as a header, such as the column names of CSV
+// files. Headers are not sorted; each input keeps its own header at the top of its rewritten file
+// and sorted runs, and empty inputs get none. The output starts with the header of the first
+// input, in the order given, that has one. Headers are not compared, so inputs with different
+// headers are merged under the header of the first. Iterators do not return the header.
+func WithHeader() Option {
+	return func(cfg *runConfig) {
+		cfg.header = true
+	}
+}
+
+// WithDelimiter sets the string written after each merged value in the output.
+// By default every value is written on its own line.
+func WithDelimiter(delimiter string) Option {
+	return func(cfg *runConfig) {
+		cfg.delimiter = delimiter
+	}
+}
+
+// WithInputCompression sets the compression of the input files and readers. By default it is
+// detected for each input, from the extension of input files or else from the first bytes of
+// the input, as gzip, zlib or bzip2; CompressionNone reads inputs as they are. Binary and
+// framed records, which may start like a compressed stream, default to CompressionExtension
+// instead, so that their first bytes are never taken for a compression header. Compressed
+// input files are never rewritten: their sorted values go to runs in the temporary directory,
+// and they are merged serially even with WithParallelMerge.
+func WithInputCompression(c Compression) Option {
+	return func(cfg *runConfig) {
+		cfg.inputCompression = c
+		cfg.inputCompressionSet = true
+	}
+}
+
+// WithOutputCompression sets the compression of the output file, CompressionGzip or
+// CompressionZlib, or with CompressionAuto the one of its extension, such as gzip for *.gz.
+// Output written to an io.Writer is not compressed. By default the output file is not
+// compressed.
+func WithOutputCompression(c Compression) Option {
+	return func(cfg *runConfig) {
+		cfg.outputCompression = c
+	}
+}
+
+// WithFileMode sets the permissions of the output file if it is created. The permissions
+// of an existing output file are not changed. By default the output file is created with
+// mode 0644.
+func WithFileMode(mode os.FileMode) Option {
+	return func(cfg *runConfig) {
+		cfg.fileMode = mode
+	}
+}
+
+// WithSync controls whether the output file, rewritten input files and sorted runs are
+// synced to disk before they are closed. Disabling sync is faster, but the written data
+// may be lost if the system crashes. By default all written files are synced.
+func WithSync(sync bool) Option {
+	return func(cfg *runConfig) {
+		cfg.sync = sync
+	}
+}
+
+// WithStable controls whether the sort and merge are stable. If stable is true, values
+// that compare equal are written in the order of the input files and, within an input
+// file, in the order in which they appear in it, so that the output is reproducible.
+// By default the order of equal values is unspecified.
+func WithStable(stable bool) Option {
+	return func(cfg *runConfig) {
+		cfg.stable = stable
+	}
+}
+
+// WithUnique drops every merged value that is equal to the previously written value, like
+// sort -u, both within and across input files. Two values are equal if neither is less than
+// the other according to the comparator. If dropped is not nil, the number of dropped
+// values is stored in it when the merge ends. In stable mode the first of the equal values
+// in input order is kept. WithUnique replaces an earlier WithReduce option.
+func WithUnique(dropped *int64) Option {
+	return func(cfg *runConfig) {
+		cfg.reduce = nil
+		cfg.unique = true
+		cfg.equal = nil
+		cfg.dropped = dropped
+	}
+}
+
+// WithUniqueFunc is like WithUnique, but detects duplicates with equal instead of the
+// comparator. equal is called with consecutive merged values, the previously written one
+// first. T must be the value type of the run, otherwise the run fails.
+func WithUniqueFunc[T any](equal func(T, T) bool, dropped *int64) Option {
+	return func(cfg *runConfig) {
+		cfg.reduce = nil
+		cfg.unique = true
+		cfg.equal = equal
+		cfg.dropped = dropped
+	}
+}
+
+// WithReduce combines every group of merged values that compare equal according to the
+// comparator into the single value returned by reduce, for example to sum counters or keep
+// the latest record per key. Groups span input files; in stable mode their values are in
+// input order. The group slice is reused between calls and must not be retained by reduce.
+// T must be the value type of the run, otherwise the run fails. WithReduce replaces an
+// earlier WithUnique option.
+func WithReduce[T any](reduce ReduceFunc[T]) Option {
+	return func(cfg *runConfig) {
+		cfg.unique = false
+		cfg.equal = nil
+		cfg.dropped = nil
+		cfg.reduce = reduce
+	}
+}
+
+// WithMaxFanIn sets the maximum number of files that are opened and merged at the same time.
+// If there are more sorted files to merge, including the runs of the sort phase, groups of
+// files are first merged into intermediate runs in the temporary directory, pass by pass,
+// until a single pass suffices. By default, or if n is 0, the fan-in is half of the limit on
+// open files of the process. Values less than 2 are treated as 2.
+func WithMaxFanIn(n int) Option {
+	return func(cfg *runConfig) {
+		if n != 0 {
+			n = max(n, 2)
+		}
+		cfg.maxFanIn = n
+	}
+}
+
+// WithMergePlan stores the passes of the merge in plan once they are planned, so that
+// callers can see how many intermediate passes a merge with the maximum fan-in needs.
+func WithMergePlan(plan *[]MergePass) Option {
+	return func(cfg *runConfig) {
+		cfg.plan = plan
+	}
+}
+
+// WithMergeEngine selects the priority queue used to merge the sorted files. The engines
+// produce the same output; EngineLoserTree is usually faster when many files are merged.
+func WithMergeEngine(engine MergeEngine) Option {
+	return func(cfg *runConfig) {
+		cfg.engine = engine
+	}
+}
+
+// WithParallelMerge splits the merge into the output file into up to n key ranges that are
+// merged at the same time. Splitter values between the ranges are chosen from values sampled
+// from the sorted files; each range is merged by its own goroutine into a segment in the
+// temporary directory, and the segments are concatenated into the output file. The output is
+// the same as that of a serial merge. Since every range opens all files, the maximum fan-in is
+// shared between the ranges. Merges that drop duplicates with WithUniqueFunc stay serial, as
+// do merges into streams and iterators. By default, or if n is 0 or 1, the merge is serial.
+func WithParallelMerge(n int) Option {
+	return func(cfg *runConfig) {
+		cfg.parallelMerge = max(n, 0)
+	}
+}
+
+// WithProgress reports the progress of the run to fn: the start of the sort and merge phases,
+// the start and end of sorting each input, the records and bytes read from each input, and
+// the records merged so far, so that callers can render progress and estimate the remaining
+// time. Periodic events are reported every 65536 records. By default, or if fn is nil,
+// no progress is reported.
+func WithProgress(fn ProgressFunc) Option {
+	return func(cfg *runConfig) {
+		cfg.progress = nil
+		if fn != nil {
+			cfg.progress = &progress{fn: fn}
+		}
+	}
+}
+
+// WithStats fills stats with the statistics of the run: the records, bytes and parse time of
+// each input, the durations of the sort and merge phases, the number of output records, the
+// peak heap size and the number of spilled runs. stats is reset when the option is applied
+// and complete once the run returns. Without unique or reduce modes, the records of all
+// inputs add up to the output records. Merges without a sort phase leave Inputs empty.
+func WithStats(stats *Stats) Option {
+	return func(cfg *runConfig) {
+		if stats != nil {
+			*stats = Stats{}
+		}
+		cfg.stats = stats
+	}
+}
@@ -0,0 +1,376 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+)
+
+// samplesPerRange is the number of values sampled from the sorted files for each key range
+// of a parallel merge.
+const samplesPerRange = 32
+
+// sample is a value read from a sorted file together with the offset at which it starts.
+type sample[T any] struct {
+	val    T
+	offset int64
+}
+
+// keyRange is a range of values merged by one goroutine of a parallel merge.
+type keyRange[T any] struct {
+	lower  *T          // Smallest value of the range, nil for no lower bound
+	upper  *T          // Smallest value above the range, nil for no upper bound
+	starts []sample[T] // For each file, the last sample less than lower, from which the range is read
+}
+
+// mergeParallel merges the values of the sorted input files into w like mergeFiles, but splits
+// the final pass into key ranges that are merged at the same time by mergeRange into segments
+// in a temporary directory, which are then concatenated into w. If the files cannot be split
+// because their sampled values are all equal, they are merged serially.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation aborts the merge
+//	inputFiles - Slice of paths to the input files containing sorted values
+//	w - Writer receiving the merged values
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	validate - Whether to check that every input file is sorted according to cmp
+//	cfg - Settings of the run
+//
+// Returns:
+//
+//	error - Any error encountered during merging or writing
+func mergeParallel[T any](ctx context.Context, inputFiles []string, w io.Writer, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) error {
+	if cfg.equal != nil || !cfg.resyncable {
+		// A custom equality function may consider values of different ranges equal, and ranges
+		// cannot be read if records cannot be found from any offset
+		return mergeFiles(ctx, inputFiles, w, parser, formatter, cmp, validate, cfg)
+	}
+	if compressed, err := anyCompressed(inputFiles, cfg); err != nil || compressed {
+		if err != nil {
+			return err
+		}
+		// Compressed files cannot be read from any offset
+		return mergeFiles(ctx, inputFiles, w, parser, formatter, cmp, validate, cfg)
+	}
+
+	// Every range opens all files, so the ranges share the maximum fan-in
+	passCfg := cfg
+	passCfg.maxFanIn = max(maxFanIn(cfg)/cfg.parallelMerge, 2)
+	files, runDir, err := mergePasses(ctx, inputFiles, parser, formatter, cmp, validate, passCfg)
+	if err != nil {
+		return err
+	}
+	defer removeRuns(runDir)
+	if runDir != "" {
+		// The input files were validated by the first pass
+		validate = false
+	}
+
+	ranges, err := splitRanges(files, parser, cmp, cfg)
+	if err != nil {
+		return err
+	}
+	if len(ranges) == 1 {
+		sources, err := openFiles(files, parser, cfg)
+		if err != nil {
+			return err
+		}
+		return mergeSources(ctx, sources, w, formatter, cmp, validate, cfg)
+	}
+
+	// Prepare a temporary directory for the segments
+	segmentDir, err := os.MkdirTemp(cfg.tempDir, "kwaymerger-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(segmentDir)
+
+	// Merge all ranges at the same time, the same way the sort phase sorts its inputs
+	dropped := make([]int64, len(ranges))
+	ends := make([][]int64, len(ranges))
+	segments, err := sortPhase(ctx, len(ranges), len(ranges), func(ctx context.Context, r int) ([]string, error) {
+		rangeCfg := cfg
+		if cfg.dropped != nil {
+			rangeCfg.dropped = &dropped[r]
+		}
+		segment, rangeEnds, err := mergeRange(ctx, files, ranges[r], segmentDir, parser, formatter, cmp, validate, rangeCfg)
+		if err != nil {
+			return nil, err
+		}
+		ends[r] = rangeEnds
+		return []string{segment}, nil
+	})
+	if cfg.dropped != nil {
+		var total int64
+		for r := range dropped {
+			total += atomic.LoadInt64(&dropped[r])
+		}
+		atomic.StoreInt64(cfg.dropped, total)
+	}
+	if err != nil {
+		return err
+	}
+
+	if validate {
+		// Each range validated the values it read. Together they read every value of a file only
+		// if each range started reading it before the previous range stopped.
+		for r := 1; r < len(ranges); r++ {
+			for i, file := range files {
+				start := ranges[r].starts[i]
+				if ends[r-1][i] >= 0 && start.offset >= ends[r-1][i] {
+					return fmt.Errorf("file %s is %w: the value at offset %d (%s) follows a value that is not less than %s",
+						file, ErrNotSorted, start.offset, formatter(start.val), formatter(*ranges[r].lower))
+				}
+			}
+		}
+	}
+
+	// Concatenate the segments in the order of their ranges, after the header of the first file
+	// that has one
+	header, err := filesHeader(files, parser, cfg)
+	if err != nil {
+		return err
+	}
+	if text, ok := header.get(); ok {
+		if _, err = io.WriteString(w, text+cfg.delimiter); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+	}
+	for _, segment := range segments {
+		if err = copyFile(w, segment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// filesHeader returns the header of the first of the files that has one, according to cfg.
+func filesHeader[T any](files []string, parser ParseFunc[T], cfg runConfig) (headerRow, error) {
+	if !cfg.header {
+		return headerRow{}, nil
+	}
+	sources, err := openFiles(files, parser, cfg)
+	if err != nil {
+		return headerRow{}, err
+	}
+	defer closeSources(sources)
+	return firstHeader(sources)
+}
+
+// splitRanges samples the sorted files in proportion to their size and splits their values
+// into at most cfg.parallelMerge key ranges of about the same number of sampled values.
+// The ranges are returned in order; there is a single range if the files cannot be split.
+func splitRanges[T any](files []string, parser ParseFunc[T], cmp func(T, T) bool, cfg runConfig) ([]keyRange[T], error) {
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file %s: %w", file, err)
+		}
+		sizes[i] = info.Size()
+		total += sizes[i]
+	}
+
+	// Sample each non-empty file
+	samples := make([][]sample[T], len(files))
+	var values []T
+	for i, file := range files {
+		if sizes[i] == 0 {
+			continue
+		}
+		n := 1 + int(int64(samplesPerRange*cfg.parallelMerge)*sizes[i]/total)
+		fileSamples, err := sampleFile(file, sizes[i], n, parser, cfg)
+		if err != nil {
+			return nil, err
+		}
+		samples[i] = fileSamples
+		for _, s := range fileSamples {
+			values = append(values, s.val)
+		}
+	}
+
+	ranges := []keyRange[T]{{starts: make([]sample[T], len(files))}}
+	if len(values) == 0 {
+		return ranges, nil
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return cmp(values[i], values[j])
+	})
+
+	// Choose splitters at evenly spaced ranks of the sampled values, skipping splitters that
+	// are not greater than the previous one, so that no range is empty
+	prev := values[0]
+	for r := 1; r < cfg.parallelMerge; r++ {
+		splitter := values[r*len(values)/cfg.parallelMerge]
+		if !cmp(prev, splitter) {
+			continue
+		}
+		prev = splitter
+		ranges[len(ranges)-1].upper = &splitter
+
+		// Values before the last sample less than the splitter are less than it as well
+		next := keyRange[T]{lower: &splitter, starts: make([]sample[T], len(files))}
+		for i := range files {
+			for _, s := range samples[i] {
+				if cmp(s.val, splitter) {
+					next.starts[i] = s
+				}
+			}
+		}
+		ranges = append(ranges, next)
+	}
+
+	return ranges, nil
+}
+
+// sampleFile reads up to n values from the sorted file of the given size, starting at the
+// first value after evenly spaced offsets.
+func sampleFile[T any](file string, size int64, n int, parser ParseFunc[T], cfg runConfig) ([]sample[T], error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", file, err)
+	}
+	defer fd.Close()
+
+	samples := make([]sample[T], 0, n)
+	for j := 0; j < n; j++ {
+		pos := size * int64(j) / int64(n)
+		if cfg.recordSize > 0 {
+			// Binary records are found at multiples of their size only
+			pos -= pos % int64(cfg.recordSize)
+		}
+		if _, err = fd.Seek(pos, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek in file %s: %w", file, err)
+		}
+		src := newSource("file "+file, fd, nil, parser, cfg)
+		src.offset = pos
+		if pos > 0 {
+			// Only the first record of a file is a header
+			src.readHeader = false
+		}
+
+		// Skip the value around pos, which may be cut
+		if pos > 0 {
+			ok, err := src.scan()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+		}
+		offset := src.offset
+		val, ok, err := src.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		samples = append(samples, sample[T]{val: val, offset: offset})
+	}
+
+	return samples, nil
+}
+
+// mergeRange merges the values of the sorted files that fall into the key range into a new
+// segment file in dir, returning the path of the segment and, for each file, the offset up to
+// which it was read, or -1 if it was read to the end.
+func mergeRange[T any](ctx context.Context, files []string, kr keyRange[T], dir string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, validate bool, cfg runConfig) (segment string, ends []int64, err error) {
+	sources := make([]*source[T], 0, len(files))
+	for i, file := range files {
+		src, err := openRange(file, kr, i, parser, cmp, cfg)
+		if err != nil {
+			closeSources(sources)
+			return "", nil, err
+		}
+		sources = append(sources, src)
+	}
+
+	// Create a new segment file in the temporary directory
+	fd, err := os.CreateTemp(dir, "segment-*.txt")
+	if err != nil {
+		closeSources(sources)
+		return "", nil, fmt.Errorf("failed to create segment file in %s: %w", dir, err)
+	}
+	// Ensure file is closed when function exits
+	defer func() {
+		closeErr := fd.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close segment file %s: %w", fd.Name(), closeErr)
+		}
+	}()
+
+	// Segments are not synced, only the output file they are copied into is, and the header of
+	// the output is written before the segments
+	seq := mergeSeq(ctx, sources, formatter, cmp, validate, cfg)
+	if err = writeSeq(fd, seq, formatter, cfg.delimiter, nil, cfg); err != nil {
+		return "", nil, fmt.Errorf("failed to write segment file %s: %w", fd.Name(), err)
+	}
+
+	ends = make([]int64, len(sources))
+	for i, src := range sources {
+		ends[i] = -1
+		if src.stopped {
+			ends[i] = src.offset
+		}
+	}
+	return fd.Name(), ends, nil
+}
+
+// openRange opens the i-th file as a source of the values in the key range.
+func openRange[T any](file string, kr keyRange[T], i int, parser ParseFunc[T], cmp func(T, T) bool, cfg runConfig) (*source[T], error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", file, err)
+	}
+
+	name := "file " + file
+	start := kr.starts[i].offset
+	if start > 0 {
+		if _, err = fd.Seek(start, io.SeekStart); err != nil {
+			fd.Close()
+			return nil, fmt.Errorf("failed to seek in file %s: %w", file, err)
+		}
+		// Records are numbered from the start of the range
+		name = fmt.Sprintf("file %s from offset %d", file, start)
+	}
+
+	src := newSource(name, fd, fd, parser, cfg)
+	src.offset = start
+	if start > 0 {
+		// Only the first record of a file is a header
+		src.readHeader = false
+	}
+	if kr.lower != nil {
+		lower := *kr.lower
+		src.skip = func(val T) bool { return cmp(val, lower) }
+	}
+	if kr.upper != nil {
+		upper := *kr.upper
+		src.stop = func(val T) bool { return !cmp(val, upper) }
+	}
+	return src, nil
+}
+
+// copyFile appends the contents of file to w.
+func copyFile(w io.Writer, file string) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open segment file %s: %w", file, err)
+	}
+	defer fd.Close()
+
+	if _, err = io.Copy(w, fd); err != nil {
+		return fmt.Errorf("failed to copy segment file %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"iter"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is the number of records read from an input or merged between two
+// progress events.
+const progressInterval = 64 << 10
+
+// Phase is a phase of a run.
+type Phase int
+
+const (
+	// PhaseSort is the phase in which the inputs are read and sorted.
+	PhaseSort Phase = iota
+	// PhaseMerge is the phase in which the sorted files are merged, including intermediate passes.
+	PhaseMerge
+)
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	switch p {
+	case PhaseSort:
+		return "sort"
+	case PhaseMerge:
+		return "merge"
+	default:
+		return "unknown"
+	}
+}
+
+// EventKind identifies what a ProgressEvent reports.
+type EventKind int
+
+const (
+	// EventPhaseStart reports that the phase of the event started.
+	EventPhaseStart EventKind = iota
+	// EventSortStart reports that an input started to be read and sorted.
+	EventSortStart
+	// EventSortProgress reports the records and bytes read from an input so far.
+	EventSortProgress
+	// EventSortFinish reports that an input is sorted, with all records and bytes read from it.
+	EventSortFinish
+	// EventMergeProgress reports the number of records merged so far.
+	EventMergeProgress
+)
+
+// ProgressEvent is an event reported to the ProgressFunc of a run.
+type ProgressEvent struct {
+	Kind    EventKind // What the event reports
+	Phase   Phase     // Phase of the run in which the event occurred
+	Input   int       // Index of the input for sort events
+	Name    string    // Path of the input file, or "input i" for readers, for sort events
+	Size    int64     // Size of the input in bytes for sort events, or -1 if unknown
+	Records int64     // Records read from the input for sort events, records merged so far for merge events
+	Bytes   int64     // Bytes read from the input for sort events
+	Total   int64     // Records to merge for merge events, or 0 if unknown because there was no sort phase
+}
+
+// ProgressFunc receives the progress events of a run. It is called for one event at a time,
+// but possibly from different goroutines, and should return quickly since the run waits for it.
+type ProgressFunc func(ProgressEvent)
+
+// progress reports the events of a run to its ProgressFunc. All methods do nothing if the
+// progress is nil, so that runs without a ProgressFunc need no checks.
+type progress struct {
+	mu      sync.Mutex
+	fn      ProgressFunc
+	phase   Phase
+	started bool  // Whether a phase started
+	sorted  int64 // Records read by the sort phase, updated atomically
+	merged  int64 // Records merged so far
+}
+
+// emit reports ev in the current phase. The caller must hold p.mu.
+func (p *progress) emit(ev ProgressEvent) {
+	ev.Phase = p.phase
+	p.fn(ev)
+}
+
+// startPhase reports the start of phase unless it is the current phase already.
+func (p *progress) startPhase(phase Phase) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started && p.phase == phase {
+		return
+	}
+	p.phase, p.started = phase, true
+	p.emit(ProgressEvent{Kind: EventPhaseStart})
+}
+
+// addMerged adds n records to the records merged so far and reports the new count.
+func (p *progress) addMerged(n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.merged += n
+	p.emit(ProgressEvent{Kind: EventMergeProgress, Records: p.merged, Total: atomic.LoadInt64(&p.sorted)})
+}
+
+// inputTracker reports the progress of sorting one input and records its statistics. All
+// methods do nothing if the tracker is nil. It is used by a single goroutine.
+type inputTracker struct {
+	progress *progress   // Receives the events of the input, may be nil
+	run      *Stats      // Statistics of the run, may be nil
+	stats    *InputStats // Statistics of the input within run, nil if run is nil
+	index    int
+	name     string
+	size     int64
+	records  int64
+	bytes    int64
+}
+
+// newInputTracker returns the tracker of the i-th input of a run with settings cfg, or nil
+// if neither progress nor statistics are reported. The statistics of the inputs must have
+// been allocated by Stats.startSort.
+func newInputTracker(cfg runConfig, i int, name string) *inputTracker {
+	if cfg.progress == nil && cfg.stats == nil {
+		return nil
+	}
+	t := &inputTracker{progress: cfg.progress, run: cfg.stats, index: i, name: name, size: -1}
+	if cfg.stats != nil {
+		t.stats = &cfg.stats.Inputs[i]
+		t.stats.Name = name
+	}
+	return t
+}
+
+// timeParse returns the result of parser for s, adding the time it took to the parse time
+// of the input if statistics are recorded.
+func timeParse[T any](t *inputTracker, parser ParseFunc[T], s string) (T, error) {
+	if t == nil || t.stats == nil {
+		return parser(s)
+	}
+	start := time.Now()
+	val, err := parser(s)
+	t.stats.ParseTime += time.Since(start)
+	return val, err
+}
+
+// event returns an event of the given kind describing the input.
+func (t *inputTracker) event(kind EventKind) ProgressEvent {
+	return ProgressEvent{Kind: kind, Input: t.index, Name: t.name, Size: t.size, Records: t.records, Bytes: t.bytes}
+}
+
+// start reports that the input of the given size, or -1 if unknown, started to be read.
+func (t *inputTracker) start(size int64) {
+	if t == nil {
+		return
+	}
+	t.size = size
+	if t.progress == nil {
+		return
+	}
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	t.progress.emit(t.event(EventSortStart))
+}
+
+// read reports the records and bytes read from the input so far.
+func (t *inputTracker) read(records int, bytes int64) {
+	if t == nil {
+		return
+	}
+	t.records, t.bytes = int64(records), bytes
+	if t.stats != nil {
+		t.stats.Records, t.stats.Bytes = t.records, t.bytes
+		t.run.sampleHeap()
+	}
+	if t.progress == nil {
+		return
+	}
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	t.progress.emit(t.event(EventSortProgress))
+}
+
+// finish reports that the input is sorted.
+func (t *inputTracker) finish() {
+	if t == nil || t.progress == nil {
+		return
+	}
+	atomic.AddInt64(&t.progress.sorted, t.records)
+	t.progress.mu.Lock()
+	defer t.progress.mu.Unlock()
+	t.progress.emit(t.event(EventSortFinish))
+}
+
+// fileSize returns the size of fd in bytes, or -1 if it cannot be determined.
+func fileSize(fd *os.File) int64 {
+	info, err := fd.Stat()
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
+// progressSeq returns an iterator over the values of seq that reports the number of values
+// yielded to p every progressInterval values and when the iteration ends.
+func progressSeq[T any](seq iter.Seq2[T, error], p *progress) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var count int64
+		defer func() { p.addMerged(count) }()
+
+		for val, err := range seq {
+			if err == nil {
+				count++
+				if count == progressInterval {
+					p.addMerged(count)
+					count = 0
+				}
+			}
+			if !yield(val, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+)
+
+// MergeSeq is like Merge, but instead of writing an output file it returns an iterator
+// over the merged values, so that callers can consume them directly:
+//
+//	for val, err := range app.MergeSeq(inputFiles, parseInt32, formatInt32, compareInt32) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// The input files are opened when the iteration starts and are all closed when it ends,
+// including when the loop is stopped early. An error ends the iteration; it is yielded
+// together with the zero value of T.
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing sorted values
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings for error messages
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the merge
+//
+// Returns:
+//
+//	iter.Seq2[T, error] - Iterator over the merged values
+func MergeSeq[T any](inputFiles []string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) iter.Seq2[T, error] {
+	cfg := newRunConfig(opts...)
+	return func(yield func(T, error) bool) {
+		var zero T
+		inputFiles, err := expandInputs(inputFiles, cfg)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer cfg.stats.timeMerge(time.Now())
+		for val, err := range mergeFilesSeq(context.Background(), inputFiles, parser, formatter, cmp, true, nil, cfg) {
+			if err != nil {
+				yield(zero, fmt.Errorf("failed to merge files: %w", err))
+				return
+			}
+			if !yield(val, nil) {
+				return
+			}
+		}
+	}
+}
+
+// RunSeq is like Run with WithPreserveInputs(true), but instead of writing an output file it
+// returns an iterator over the merged values. The input files are sorted into runs in a
+// temporary directory created under the directory set by WithTempDir when the iteration
+// starts. The runs are merged as the iterator is consumed, and the temporary directory is
+// removed when the iteration ends, including when the loop is stopped early. An error ends
+// the iteration; it is yielded together with the zero value of T. WithPreserveInputs is
+// ignored.
+//
+// Parameters:
+//
+//	inputFiles - Slice of paths to the input files containing unsorted values
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for ordering values of type T
+//	opts - Options configuring the run
+//
+// Returns:
+//
+//	iter.Seq2[T, error] - Iterator over the merged values
+func RunSeq[T any](inputFiles []string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, opts ...Option) iter.Seq2[T, error] {
+	cfg := newRunConfig(opts...)
+	cfg.preserveInputs = true
+	return func(yield func(T, error) bool) {
+		var zero T
+		inputFiles, err := expandInputs(inputFiles, cfg)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		sortedFiles, runDir, err := sortFiles(context.Background(), inputFiles, parser, formatter, cmp, cfg)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer removeRuns(runDir)
+		// The sorted files and runs are never compressed
+		mergeCfg := cfg
+		mergeCfg.inputCompression = CompressionNone
+
+		defer cfg.stats.timeMerge(time.Now())
+		for val, err := range mergeFilesSeq(context.Background(), sortedFiles, parser, formatter, cmp, false, nil, mergeCfg) {
+			if err != nil {
+				yield(zero, fmt.Errorf("failed to merge files: %w", err))
+				return
+			}
+			if !yield(val, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// cancelCheckInterval is the number of records read or merged between two checks
+// of whether the context of a run has been canceled.
+const cancelCheckInterval = 1024
+
+// sortPhase sorts n inputs with up to concurrency goroutines by calling sortInput
+// with the index of each input. The context passed to sortInput is canceled as soon as
+// ctx is canceled or any call fails, so that the other calls can stop early, and no
+// further inputs are started.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation stops the sort phase
+//	n - Number of inputs to sort
+//	concurrency - Maximum number of inputs to sort at the same time
+//	sortInput - Function sorting one input and returning the paths of its sorted files
+//
+// Returns:
+//
+//	[]string - The paths of the sorted files of all inputs, in input order
+//	error - The first error returned by sortInput, or the error of ctx if it was canceled
+func sortPhase(ctx context.Context, n, concurrency int, sortInput func(ctx context.Context, i int) ([]string, error)) ([]string, error) {
+	// Cancel the remaining inputs on the first failure
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Create a semaphore to control concurrency
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	runs := make([][]string, n)
+
+	// Sort each input in parallel
+	for i := 0; i < n; i++ {
+		// Acquire semaphore, unless the phase is canceled while waiting for it
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }() // Release semaphore
+
+			inputRuns, err := sortInput(ctx, i)
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+				cancel()
+				return
+			}
+			runs[i] = inputRuns
+		}(i)
+	}
+
+	// Wait for all sorting goroutines to complete
+	wg.Wait()
+
+	// Check if any sorting operation failed or the phase was canceled
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Keep the sorted files in the order of the inputs
+	var sortedFiles []string
+	for _, inputRuns := range runs {
+		sortedFiles = append(sortedFiles, inputRuns...)
+	}
+	return sortedFiles, nil
+}
+
+// readSortRewrite reads values of type T from a file, sorts them using the provided comparator,
+// and rewrites the sorted values back to the same file using the provided formatter.
+//
+// If budget is positive and the parsed values of the file would take more than budget bytes,
+// the file is left untouched and its contents are instead split into sorted runs, each holding
+// at most about budget bytes of values, written to spillDir. If cfg.preserveInputs is true, the
+// file is never rewritten and its sorted values always go to a run in spillDir, as do those of
+// compressed files, which are decompressed while they are read.
+//
+// Reading stops early once ctx is canceled. A file that is being rewritten is always
+// written completely, so that cancellation never leaves it truncated.
+//
+// Parameters:
+//
+//	ctx - Context whose cancellation stops reading the file
+//	file - The path to the file to be read, sorted, and rewritten
+//	parser - Function to parse string values into type T
+//	formatter - Function to format values of type T into strings
+//	cmp - Comparator function for sorting values of type T
+//	budget - Approximate number of bytes of values to hold in memory, or 0 for no limit
+//	spillDir - Directory where sorted runs are written when the file is not rewritten
+//	tracker - Reports the progress of sorting the file, may be nil
+//	cfg - Settings of the run
+//
+// Returns:
+//
+//	[]string - The paths of the sorted files to merge, in order
+//	error - Any error encountered during reading, sorting, or writing
+func readSortRewrite[T any](ctx context.Context, file string, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, budget int64, spillDir string, tracker *inputTracker, cfg runConfig) (runs []string, err error) {
+	// Open file for reading
+	fd, r, compressed, err := openInput(file, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Ensure file is closed when function exits
+	defer func() {
+		closeErr := fd.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close file %s: %w", file, closeErr)
+		}
+	}()
+
+	// Sort the file, spilling runs if it does not fit into the budget
+	size := fileSize(fd)
+	if compressed {
+		// The size of the decompressed contents is unknown
+		size = -1
+	}
+	tracker.start(size)
+	src := newSource("file "+file, r, nil, parser, cfg)
+	src.tracker = tracker
+	runs, list, err := sortStream(ctx, src, formatter, cmp, budget, spillDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) > 0 || cfg.preserveInputs || compressed {
+		return finishRuns(runs, list, spillDir, formatter, "file "+file, &src.header, cfg)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Open file for writing (truncate existing content)
+	fd2, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s for writing: %w", file, err)
+	}
+	// Ensure file is closed when function exits
+	defer func() {
+		closeErr := fd2.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close file %s: %w", file, closeErr)
+		}
+	}()
+
+	// Write sorted values back to file, after its own header
+	if err = writeValues(fd2, list, formatter, &src.header, cfg); err != nil {
+		return nil, fmt.Errorf("failed to write file %s: %w", file, err)
+	}
+
+	return []string{file}, nil
+}
+
+// readSortSpill reads values of type T from r and writes them as one or more sorted runs
+// to spillDir, each holding at most about budget bytes of values if budget is positive. r is
+// decompressed according to cfg.
+// It returns the paths of the runs in order. Reading stops early once ctx is canceled.
+// If tracker is not nil, it reports the progress of reading r.
+func readSortSpill[T any](ctx context.Context, name string, r io.Reader, parser ParseFunc[T], formatter FormatFunc[T], cmp func(T, T) bool, budget int64, spillDir string, tracker *inputTracker, cfg runConfig) ([]string, error) {
+	tracker.start(-1)
+	r, _, err := decompress(name, r, cfg.inputCompression)
+	if err != nil {
+		return nil, err
+	}
+	src := newSource(name, r, nil, parser, cfg)
+	src.tracker = tracker
+	runs, list, err := sortStream(ctx, src, formatter, cmp, budget, spillDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return finishRuns(runs, list, spillDir, formatter, name, &src.header, cfg)
+}
+
+// sortStream reads all values of src, spilling a sorted run to spillDir whenever the values
+// read so far exceed budget bytes. It returns the spilled runs and the remaining values in
+// sorted order, or the error of ctx if it is canceled before all values are read.
+func sortStream[T any](ctx context.Context, src *source[T], formatter FormatFunc[T], cmp func(T, T) bool, budget int64, spillDir string, cfg runConfig) (runs []string, list []T, err error) {
+	// Estimate the in-memory footprint of a value as its fixed size plus its textual length
+	var zero T
+	valueSize := int64(unsafe.Sizeof(zero))
+
+	var size int64
+	for {
+		val, ok, nextErr := src.next()
+		if nextErr != nil {
+			return nil, nil, nextErr
+		}
+		if !ok {
+			break
+		}
+		if src.record%cancelCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if src.record%progressInterval == 0 {
+			src.tracker.read(src.record, src.offset)
+		}
+		list = append(list, val)
+		size += valueSize + int64(len(src.scanner.Bytes()))
+
+		// Spill a sorted run once the values read so far exceed the budget
+		if budget > 0 && size >= budget {
+			cfg.stats.sampleHeap()
+			sortValues(list, cmp, cfg.stable)
+			run, spillErr := spillRun(list, spillDir, formatter, &src.header, cfg)
+			if spillErr != nil {
+				return nil, nil, fmt.Errorf("failed to spill run for %s: %w", src.name, spillErr)
+			}
+			runs = append(runs, run)
+			clear(list)
+			list = list[:0]
+			size = 0
+		}
+	}
+
+	src.tracker.read(src.record, src.offset)
+	sortValues(list, cmp, cfg.stable)
+	return runs, list, nil
+}
+
+// sortValues sorts list using the provided comparator. If stable is true,
+// values that compare equal keep their order.
+func sortValues[T any](list []T, cmp func(T, T) bool, stable bool) {
+	less := func(i, j int) bool {
+		return cmp(list[i], list[j])
+	}
+	if stable {
+		sort.SliceStable(list, less)
+		return
+	}
+	sort.Slice(list, less)
+}
+
+// finishRuns spills the sorted values left over by sortStream, if any, as a final run
+// and returns all runs of the input described by name. An input with a header but no values
+// is spilled as a run holding only its header, so that the header reaches the output.
+func finishRuns[T any](runs []string, list []T, spillDir string, formatter FormatFunc[T], name string, header *headerRow, cfg runConfig) ([]string, error) {
+	if len(list) > 0 || len(runs) == 0 && header.ok {
+		run, err := spillRun(list, spillDir, formatter, header, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to spill run for %s: %w", name, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// spillRun writes the sorted values of list to a new run file in dir, after header if it holds
+// one, returning the path of the run. The run is written and synced according to cfg.
+func spillRun[T any](list []T, dir string, formatter FormatFunc[T], header *headerRow, cfg runConfig) (run string, err error) {
+	// Create a new run file in the spill directory
+	fd, err := os.CreateTemp(dir, "run-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create run file in %s: %w", dir, err)
+	}
+	// Ensure file is closed when function exits
+	defer func() {
+		closeErr := fd.Close()
+		if closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close run file %s: %w", fd.Name(), closeErr)
+		}
+	}()
+
+	if err = writeValues(fd, list, formatter, header, cfg); err != nil {
+		return "", fmt.Errorf("failed to write run file %s: %w", fd.Name(), err)
+	}
+
+	cfg.stats.addSpillRun()
+	return fd.Name(), nil
+}
+
+// writeValues writes header, if it holds one, and each value of list, encoded or
+// formatted and followed by the record terminator of cfg, to fd through a buffer of the write buffer size of cfg, flushes it,
+// and syncs fd to disk if cfg.sync is true.
+func writeValues[T any](fd *os.File, list []T, formatter FormatFunc[T], header *headerRow, cfg runConfig) error {
+	bw := bufio.NewWriterSize(fd, cfg.writeBufferSize)
+	writeHeader(bw, header, cfg.terminator)
+	write := valueWriter(formatter, cfg.terminator, cfg)
+	for i := 0; i < len(list); i++ {
+		if err := write(bw, list[i]); err != nil {
+			return err
+		}
+	}
+
+	// Flush buffered values before syncing, so that write errors are not lost
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if !cfg.sync {
+		return nil
+	}
+	// Sync file to ensure data is written to disk
+	return fd.Sync()
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// source streams values of type T parsed from the records of a reader, which are the
+// whitespace-separated words of the reader unless configured otherwise.
+type source[T any] struct {
+	name          string         // Description of the input used in error messages, e.g. "file data.txt"
+	scanner       *bufio.Scanner // Scanner splitting the input into records
+	closer        io.Closer      // Closed once the source is exhausted or closed, may be nil
+	parser        ParseFunc[T]   // Function to parse records into type T
+	record        int            // Number of the last record read, starting at 1
+	offset        int64          // Offset in the input of the first byte not consumed by the scanner
+	skip          func(T) bool   // Leading values for which skip reports true are dropped, may be nil
+	stop          func(T) bool   // The source ends before the first value for which stop reports true, may be nil
+	stopped       bool           // Whether the source ended because of stop
+	maxRecordSize int            // Maximum size in bytes of a record including its terminator
+	tracker       *inputTracker  // Reports the progress of sorting the source, may be nil
+	readHeader    bool           // Whether the first record of the input is a header not read yet
+	header        headerRow      // Header of the input, once read
+	decode        func([]byte) T // Decodes binary records instead of parser, nil for text records
+}
+
+// headerRow holds the header of an input, its first record, which is kept out of the sort and
+// written at the top of the files written from the input.
+type headerRow struct {
+	text string
+	ok   bool // Whether the input has a header, false if it is empty
+}
+
+// get returns the header and whether one was read. It reports false if h is nil.
+func (h *headerRow) get() (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	return h.text, h.ok
+}
+
+// newSource returns a source reading values from r. If closer is not nil,
+// it is closed together with the source. The records of r are split and read
+// according to cfg; if cfg.header is true, the first record is read as a header.
+func newSource[T any](name string, r io.Reader, closer io.Closer, parser ParseFunc[T], cfg runConfig) *source[T] {
+	scanner := bufio.NewScanner(r)
+	maxRecordSize := recordSizeLimit(cfg)
+	bufferSize := cfg.readBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultReadBufferSize
+	}
+	scanner.Buffer(make([]byte, 0, min(bufferSize, maxRecordSize)), maxRecordSize)
+	split := cfg.split
+	if split == nil {
+		split = bufio.ScanWords // Split on whitespace
+	}
+	src := &source[T]{name: name, scanner: scanner, closer: closer, parser: parser, maxRecordSize: maxRecordSize, readHeader: cfg.header}
+	if codec, ok := cfg.codec.(recordCodec[T]); ok {
+		src.decode = codec.decode
+	}
+	// Keep track of the consumed bytes
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		src.offset += int64(advance)
+		return advance, token, err
+	})
+	return src
+}
+
+// scanDelimited returns a split function for records terminated by delim. The last
+// record of the input does not need to be terminated.
+func scanDelimited(delim byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		// Request more data
+		return 0, nil, nil
+	}
+}
+
+// next reads and parses the next value of the source. It reports false
+// without an error once the source is exhausted or stopped.
+func (s *source[T]) next() (val T, ok bool, err error) {
+	if err = s.readFirstHeader(); err != nil {
+		return val, false, err
+	}
+	for !s.stopped {
+		if ok, err = s.scan(); !ok {
+			var zero T
+			return zero, false, err
+		}
+		s.record++
+
+		if s.decode != nil {
+			val = s.decode(s.scanner.Bytes())
+		} else if val, err = timeParse(s.tracker, s.parser, s.scanner.Text()); err != nil {
+			return val, false, fmt.Errorf("failed to parse value in %s: %w", s.name, err)
+		}
+		if s.skip != nil {
+			if s.skip(val) {
+				continue
+			}
+			s.skip = nil
+		}
+		if s.stop != nil && s.stop(val) {
+			s.stopped = true
+			break
+		}
+		return val, true, nil
+	}
+
+	var zero T
+	return zero, false, nil
+}
+
+// readFirstHeader reads the first record of the source as its header if it has not been read
+// yet. An empty source has no header.
+func (s *source[T]) readFirstHeader() error {
+	if !s.readHeader {
+		return nil
+	}
+	// The first record of the input is its header, which is not a value
+	s.readHeader = false
+	ok, err := s.scan()
+	if ok {
+		s.header = headerRow{text: s.scanner.Text(), ok: true}
+	}
+	return err
+}
+
+// firstHeader reads the headers of the sources and returns the first one in their order, so
+// that the header of a merge does not depend on which source is read first.
+func firstHeader[T any](sources []*source[T]) (headerRow, error) {
+	var header headerRow
+	for _, src := range sources {
+		if err := src.readFirstHeader(); err != nil {
+			return headerRow{}, err
+		}
+		if !header.ok {
+			header = src.header
+		}
+	}
+	return header, nil
+}
+
+// scan advances the scanner of the source to the next record without parsing it. It reports
+// false once the source is exhausted or an error occurs.
+func (s *source[T]) scan() (bool, error) {
+	if s.scanner.Scan() {
+		return true, nil
+	}
+	err := s.scanner.Err()
+	if err == nil {
+		return false, nil
+	}
+	if errors.Is(err, bufio.ErrTooLong) {
+		// The offset is that of the record, since the scanner consumes nothing of it
+		return false, fmt.Errorf("failed to read %s: record at offset %d exceeds the maximum record size of %d bytes: %w",
+			s.name, s.offset, s.maxRecordSize, err)
+	}
+	return false, fmt.Errorf("failed to read %s: %w", s.name, err)
+}
+
+// recordSizeLimit returns the maximum size in bytes of a record, including its terminator,
+// according to cfg.
+func recordSizeLimit(cfg runConfig) int {
+	switch {
+	case cfg.maxRecordSize < 0:
+		return math.MaxInt
+	case cfg.maxRecordSize == 0:
+		return max(bufio.MaxScanTokenSize, cfg.readBufferSize)
+	default:
+		return max(cfg.maxRecordSize, cfg.readBufferSize)
+	}
+}
+
+// close closes the underlying reader of the source if it has a closer.
+// It is safe to call close more than once.
+func (s *source[T]) close() error {
+	if s.closer == nil {
+		return nil
+	}
+	closer := s.closer
+	s.closer = nil
+	if err := closer.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", s.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"iter"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// heapMetric is the runtime metric sampled for the peak heap size of a run.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Stats holds the statistics of a run, filled in by the WithStats option. Fields updated
+// while the run is in progress must not be read before it returns.
+type Stats struct {
+	Inputs        []InputStats  // Statistics of each input of the sort phase, in input order
+	SortDuration  time.Duration // Duration of the sort phase
+	MergeDuration time.Duration // Duration of the merge phase, including intermediate passes
+	OutputRecords int64         // Number of values written to the output
+	PeakHeapBytes uint64        // Largest size in bytes of the heap objects of the process sampled during the run
+	SpillRuns     int64         // Number of sorted runs written to the temporary directory by the sort phase
+}
+
+// InputStats holds the statistics of reading and sorting one input.
+type InputStats struct {
+	Name      string        // Path of the input file, or "input i" for readers
+	Records   int64         // Number of values read from the input
+	Bytes     int64         // Number of bytes read from the input
+	ParseTime time.Duration // Total time spent parsing the values of the input
+}
+
+// startSort allocates the statistics of n inputs. It does nothing if s is nil.
+func (s *Stats) startSort(n int) {
+	if s != nil {
+		s.Inputs = make([]InputStats, n)
+	}
+}
+
+// timeSort stores the time elapsed since start as the duration of the sort phase.
+// It does nothing if s is nil.
+func (s *Stats) timeSort(start time.Time) {
+	if s != nil {
+		s.SortDuration = time.Since(start)
+	}
+}
+
+// timeMerge stores the time elapsed since start as the duration of the merge phase.
+// It does nothing if s is nil.
+func (s *Stats) timeMerge(start time.Time) {
+	if s != nil {
+		s.MergeDuration = time.Since(start)
+	}
+}
+
+// sampleHeap updates the peak heap size with the current size of the heap objects.
+// It does nothing if s is nil.
+func (s *Stats) sampleHeap() {
+	if s == nil {
+		return
+	}
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+	size := sample[0].Value.Uint64()
+	for {
+		peak := atomic.LoadUint64(&s.PeakHeapBytes)
+		if size <= peak || atomic.CompareAndSwapUint64(&s.PeakHeapBytes, peak, size) {
+			return
+		}
+	}
+}
+
+// addSpillRun counts a run written by the sort phase. It does nothing if s is nil.
+func (s *Stats) addSpillRun() {
+	if s != nil {
+		atomic.AddInt64(&s.SpillRuns, 1)
+	}
+}
+
+// statsSeq returns an iterator over the values of seq that adds the number of values yielded
+// to the output records of s when the iteration ends, sampling the heap every progressInterval
+// values and at the end.
+func statsSeq[T any](seq iter.Seq2[T, error], s *Stats) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var count int64
+		defer func() {
+			atomic.AddInt64(&s.OutputRecords, count)
+			s.sampleHeap()
+		}()
+
+		for val, err := range seq {
+			if err == nil {
+				count++
+				if count%progressInterval == 0 {
+					s.sampleHeap()
+				}
+			}
+			if !yield(val, err) {
+				return
+			}
+		}
+	}
+}
@@ -12,11 +12,15 @@ import (
 
 type Comparator[T any] func(a, b T) bool
 
-// Node holds a value of type T read from a file,
-// along with the file descriptor and a Scanner for further reads.
+// Node holds a value of type T read from one of the merged inputs,
+// along with the index of that input so that further values can be read from it.
 
 type Node[T any] struct {
-	Val     T
+	Val   T
+	Index int
+
+	// Deprecated: Fd and Scanner are only set by NewNode. Merges read their inputs through
+	// the index of the node instead.
 	Fd      *os.File
 	Scanner *bufio.Scanner
 }
@@ -27,10 +31,14 @@ type Node[T any] struct {
 type Heap[T any] struct {
 	nodes      []Node[T]
 	comparator Comparator[T]
+	stable     bool
 }
 
 // NewNode creates a new Node with a custom value type by opening the specified file
 // and reading the first value using the provided parser function.
+//
+// Deprecated: Merges no longer read their inputs through nodes. Use the entry points of
+// the app package, such as app.Merge or app.MergeStreams, to merge files or readers.
 
 func NewNode[T any](filename string, parser func(string) (T, error)) (Node[T], error) {
 	fd, err := os.Open(filename)
@@ -71,6 +79,15 @@ func NewHeap[T any](capacity int, comparator Comparator[T]) *Heap[T] {
 	return h
 }
 
+// NewStableHeap is like NewHeap, but breaks ties between nodes whose values compare equal
+// by their Index, so that the node with the smaller Index is popped first.
+
+func NewStableHeap[T any](capacity int, comparator Comparator[T]) *Heap[T] {
+	h := NewHeap(capacity, comparator)
+	h.stable = true
+	return h
+}
+
 // Len returns the number of elements in the heap.
 
 func (h *Heap[T]) Len() int {
@@ -78,10 +95,17 @@ func (h *Heap[T]) Len() int {
 }
 
 // Less reports whether the element at index i is less than the one at j
-// using the heap's comparator function.
+// using the heap's comparator function. Stable heaps order equal values by Index.
 
 func (h *Heap[T]) Less(i, j int) bool {
-	return h.comparator(h.nodes[i].Val, h.nodes[j].Val)
+	a, b := h.nodes[i], h.nodes[j]
+	if h.comparator(a.Val, b.Val) {
+		return true
+	}
+	if !h.stable || h.comparator(b.Val, a.Val) {
+		return false
+	}
+	return a.Index < b.Index
 }
 
 // Swap swaps the elements at indices i and j.
@@ -0,0 +1,159 @@
+package heap
+
+// LoserTree is a tournament tree that holds at most one Node[T] for each of a fixed number
+// of inputs, identified by Node.Index. It provides the same PushNode, PopNode and Empty
+// methods as Heap and is meant for merges, where a popped node is replaced by the next
+// node of the same input. Such a replacement takes about log K comparisons and no
+// allocations. Pushing the node of any other input is allowed, but makes the next PopNode
+// replay the whole tournament, which takes K comparisons.
+
+type LoserTree[T any] struct {
+	leaves     []Node[T] // Current node of each input, indexed by Node.Index
+	active     []bool    // Whether each input currently holds a node
+	tree       []int     // tree[0] is the input of the winner, tree[1:] the input losing each match
+	winners    []int     // Scratch space for the winner of each match when the tournament is replayed
+	count      int       // Number of inputs holding a node
+	pending    int       // Input whose node was popped but not yet replaced, or -1
+	dirty      bool      // Whether nodes were pushed since the tournament was last played
+	comparator Comparator[T]
+	stable     bool
+}
+
+// NewLoserTree creates a new loser tree for inputs with indices 0 to k-1, ordered by the
+// given comparator.
+
+func NewLoserTree[T any](k int, comparator Comparator[T]) *LoserTree[T] {
+	k = max(k, 1)
+	t := &LoserTree[T]{
+		leaves:     make([]Node[T], k),
+		active:     make([]bool, k),
+		tree:       make([]int, k),
+		winners:    make([]int, 2*k),
+		pending:    -1,
+		comparator: comparator,
+	}
+	t.play()
+	return t
+}
+
+// NewStableLoserTree is like NewLoserTree, but breaks ties between nodes whose values
+// compare equal by their Index, so that the node with the smaller Index is popped first.
+
+func NewStableLoserTree[T any](k int, comparator Comparator[T]) *LoserTree[T] {
+	t := NewLoserTree(k, comparator)
+	t.stable = true
+	return t
+}
+
+// less reports whether input a wins against input b. Inputs without a node lose
+// against all others.
+
+func (t *LoserTree[T]) less(a, b int) bool {
+	if !t.active[a] || !t.active[b] {
+		if t.active[a] != t.active[b] {
+			return t.active[a]
+		}
+		return a < b
+	}
+	if t.comparator(t.leaves[a].Val, t.leaves[b].Val) {
+		return true
+	}
+	if !t.stable || t.comparator(t.leaves[b].Val, t.leaves[a].Val) {
+		return false
+	}
+	return a < b
+}
+
+// play plays the whole tournament bottom-up, the leaf of input i being at position k+i.
+
+func (t *LoserTree[T]) play() {
+	k := len(t.leaves)
+	for i := 0; i < k; i++ {
+		t.winners[k+i] = i
+	}
+	for p := k - 1; p > 0; p-- {
+		a, b := t.winners[2*p], t.winners[2*p+1]
+		if t.less(b, a) {
+			a, b = b, a
+		}
+		t.winners[p], t.tree[p] = a, b
+	}
+	t.tree[0] = t.winners[1]
+	t.dirty = false
+}
+
+// replay replays the matches on the path from input i to the root. It is only valid
+// if input i is the winner of the current tournament.
+
+func (t *LoserTree[T]) replay(i int) {
+	winner := i
+	for p := (i + len(t.leaves)) / 2; p > 0; p /= 2 {
+		if t.less(t.tree[p], winner) {
+			t.tree[p], winner = winner, t.tree[p]
+		}
+	}
+	t.tree[0] = winner
+}
+
+// settle removes the node of the pending input, which was popped without being replaced.
+
+func (t *LoserTree[T]) settle() {
+	if t.pending >= 0 {
+		i := t.pending
+		t.pending = -1
+		t.active[i] = false
+		if !t.dirty {
+			t.replay(i)
+		}
+	}
+}
+
+// Len returns the number of nodes in the tree.
+
+func (t *LoserTree[T]) Len() int {
+	return t.count
+}
+
+// Empty reports whether the tree contains no nodes.
+
+func (t *LoserTree[T]) Empty() bool {
+	return t.count == 0
+}
+
+// PushNode inserts node as the node of input node.Index, which must not hold a node.
+// Pushing the next node of the input that was popped last replaces it in a single replay.
+
+func (t *LoserTree[T]) PushNode(node Node[T]) {
+	i := node.Index
+	if t.pending == i && !t.dirty {
+		t.pending = -1
+		t.leaves[i] = node
+		t.active[i] = true
+		t.count++
+		t.replay(i)
+		return
+	}
+
+	// Any other push invalidates the tournament until the next PopNode
+	t.settle()
+	t.leaves[i] = node
+	t.active[i] = true
+	t.count++
+	t.dirty = true
+}
+
+// PopNode removes and returns the smallest node according to the comparator.
+
+func (t *LoserTree[T]) PopNode() Node[T] {
+	t.settle()
+	if t.dirty {
+		t.play()
+	}
+	winner := t.tree[0]
+	if !t.active[winner] {
+		panic("heap: PopNode on empty LoserTree")
+	}
+	t.pending = winner
+	t.count--
+	return t.leaves[winner]
+}
@@ -1,8 +1,332 @@
-// This file is intentionally left empty as the K-Way Merger is intended to be used as a library.
-// For examples on how to use the library, please refer to the examples directory or documentation.
-
+// Command kwaymerger sorts and merges the whitespace-separated values of several
+// input files into a single sorted output, comparing values by their type.
+//
+// Usage:
+//
+//	kwaymerger [flags] input1 ... inputN outputFile
+//	kwaymerger [flags] -o output [input1 ... inputN]
+//
+// Without -o the last argument is the output file. With -o all arguments are inputs, and
+// the output "-" is the standard output. Without inputs the values are read from the
+// standard input; without any arguments or -o they are written to the standard output.
+//
+// Values are compared as strings, or as the numbers of the type given by -type: int32,
+// int64, uint64 or float64.
+//
+// Values are written in ascending order, or descending with -reverse (-r), and only the
+// first of equal values is written with -unique (-u).
+//
+// Input files are never modified by default: each is sorted into runs under -tempdir before
+// the merge, with -concurrency files sorted at the same time and at most -memory bytes of
+// values held in memory. With -in-place, input files written to an output file are instead
+// rewritten with their sorted values, except those that do not fit into memory. With -merge
+// the inputs must already be sorted in the order of the output; they are merged directly.
+//
+// Inputs may be glob patterns, quoted to keep the shell from expanding them, and
+// directories, which stand for the files in them, or below them with -recursive. Files
+// found this way are filtered by -include and -exclude, which may be repeated, and skipped
+// if they are hidden unless -hidden is given. Inputs are expanded in the order given, and
+// each into files in lexical order.
+//
+// The exit status is 0 if the output was written, 1 if the run failed, 2 if the command
+// line is invalid, and 3 if an input of -merge is not sorted.
 package main
 
+import (
+	"KWayMerger/app"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Exit statuses of the command.
+const (
+	exitOK       = 0 // The output was written
+	exitFailure  = 1 // The run failed, for example because an input could not be read or parsed
+	exitUsage    = 2 // The command line is invalid
+	exitUnsorted = 3 // An input of -merge is not sorted
+)
+
+// stdio is the name of the standard input and output on the command line.
+const stdio = "-"
+
+// command holds the settings of the command given by its flags and arguments.
+type command struct {
+	valueType   string
+	merge       bool
+	inPlace     bool
+	reverse     bool
+	unique      bool
+	output      string
+	concurrency int
+	memoryLimit int64
+	tempDir     string
+	expansion   app.InputExpansion
+	inputs      []string
+	stdin       io.Reader
+	stdout      io.Writer
+}
+
+// parseString simply returns the input string as is.
+func parseString(s string) (string, error) {
+	return s, nil
+}
+
+// formatString simply returns the input string as is.
+func formatString(s string) string {
+	return s
+}
+
+// compareString compares two strings lexicographically.
+func compareString(a, b string) bool {
+	return a < b
+}
+
+// parseInt32 parses a decimal 32-bit integer.
+func parseInt32(s string) (int32, error) {
+	n, err := strconv.ParseInt(s, 10, 32)
+	return int32(n), err
+}
+
+// formatInt32 formats a 32-bit integer in decimal.
+func formatInt32(n int32) string {
+	return strconv.FormatInt(int64(n), 10)
+}
+
+// parseInt64 parses a decimal 64-bit integer.
+func parseInt64(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// formatInt64 formats a 64-bit integer in decimal.
+func formatInt64(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+// parseUint64 parses a decimal unsigned 64-bit integer.
+func parseUint64(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// formatUint64 formats an unsigned 64-bit integer in decimal.
+func formatUint64(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
+
+// parseFloat64 parses a floating-point number, including "Inf" and "NaN".
+func parseFloat64(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+// formatFloat64 formats a floating-point number with the fewest digits that parse back to it.
+func formatFloat64(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// compareFloat64 compares two floating-point numbers, ordering NaN before all other numbers so
+// that the order is total.
+func compareFloat64(a, b float64) bool {
+	return a < b || math.IsNaN(a) && !math.IsNaN(b)
+}
+
+// compareOrdered compares two integers numerically.
+func compareOrdered[T int32 | int64 | uint64](a, b T) bool {
+	return a < b
+}
+
 func main() {
-	// No implementation needed for library usage
+	os.Exit(runCommand(os.Args[0], os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// runCommand runs the command named name with the given arguments and standard streams, and
+// returns its exit status.
+func runCommand(name string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd, err := parseCommand(name, args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitUsage
+	}
+	cmd.stdin, cmd.stdout = stdin, stdout
+
+	switch cmd.valueType {
+	case "int32":
+		err = runTyped(cmd, parseInt32, formatInt32, compareOrdered[int32])
+	case "int64":
+		err = runTyped(cmd, parseInt64, formatInt64, compareOrdered[int64])
+	case "uint64":
+		err = runTyped(cmd, parseUint64, formatUint64, compareOrdered[uint64])
+	case "float64":
+		err = runTyped(cmd, parseFloat64, formatFloat64, compareFloat64)
+	default:
+		err = runTyped(cmd, parseString, formatString, compareString)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		if errors.Is(err, app.ErrNotSorted) {
+			return exitUnsorted
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+// parseCommand parses the flags and arguments of the command named name, writing usage
+// errors to stderr.
+func parseCommand(name string, args []string, stderr io.Writer) (command, error) {
+	var cmd command
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cmd.valueType, "type", "string", "compare values as `type` string, int32, int64, uint64 or float64")
+	fs.BoolVar(&cmd.merge, "merge", false, "merge already sorted inputs without sorting them first")
+	fs.BoolVar(&cmd.inPlace, "in-place", false, "rewrite input files with their sorted values instead of sorting them into temporary runs")
+	fs.BoolVar(&cmd.reverse, "reverse", false, "write values in descending order")
+	fs.BoolVar(&cmd.reverse, "r", false, "shorthand for -reverse")
+	fs.BoolVar(&cmd.unique, "unique", false, "write only the first of equal values")
+	fs.BoolVar(&cmd.unique, "u", false, "shorthand for -unique")
+	fs.StringVar(&cmd.output, "o", "", "write the output to `file`, or to the standard output if it is -")
+	fs.IntVar(&cmd.concurrency, "concurrency", 0, "sort at most `n` input files at the same time (default the number of CPUs)")
+	fs.Int64Var(&cmd.memoryLimit, "memory", 0, "hold about `bytes` of values in memory while sorting, spilling the rest into sorted runs (default no limit)")
+	fs.StringVar(&cmd.tempDir, "tempdir", "", "write sorted runs to `dir` (default the system temporary directory)")
+	fs.BoolVar(&cmd.expansion.Recursive, "recursive", false, "include the files below directory inputs, not only those directly in them")
+	fs.Func("include", "only include expanded files whose names match `pattern` (repeatable)", func(pattern string) error {
+		cmd.expansion.Include = append(cmd.expansion.Include, pattern)
+		return nil
+	})
+	fs.Func("exclude", "exclude expanded files and directories whose names match `pattern` (repeatable)", func(pattern string) error {
+		cmd.expansion.Exclude = append(cmd.expansion.Exclude, pattern)
+		return nil
+	})
+	fs.BoolVar(&cmd.expansion.Hidden, "hidden", false, "include expanded files and directories whose names start with a dot")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  %s [flags] input1 ... inputN outputFile\n  %s [flags] -o output [input1 ... inputN]\n\nFlags:\n", name, name)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return command{}, err
+	}
+	usageError := func(format string, a ...any) (command, error) {
+		err := fmt.Errorf(format, a...)
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		fs.Usage()
+		return command{}, err
+	}
+
+	switch cmd.valueType {
+	case "string", "int32", "int64", "uint64", "float64":
+	default:
+		return usageError("unknown value type %q", cmd.valueType)
+	}
+	if cmd.concurrency < 0 {
+		return usageError("invalid concurrency %d", cmd.concurrency)
+	}
+	if cmd.memoryLimit < 0 {
+		return usageError("invalid memory limit %d", cmd.memoryLimit)
+	}
+
+	cmd.inputs = fs.Args()
+	switch {
+	case cmd.output != "":
+		// All arguments are inputs
+	case len(cmd.inputs) == 0:
+		cmd.output = stdio
+	case len(cmd.inputs) == 1:
+		return usageError("missing output file, give it after the inputs or with -o")
+	default:
+		// The last argument is the output file, all others are inputs
+		cmd.inputs, cmd.output = cmd.inputs[:len(cmd.inputs)-1], cmd.inputs[len(cmd.inputs)-1]
+	}
+	return cmd, nil
+}
+
+// runTyped runs cmd on values of type T parsed by parser, formatted by formatter and compared
+// by cmp. Input files are sorted by Run or merged by Merge into an output file, and by RunSeq
+// or MergeSeq to the standard output. The standard input is read by RunStreams or MergeStreams.
+func runTyped[T any](cmd command, parser app.ParseFunc[T], formatter app.FormatFunc[T], cmp func(T, T) bool) error {
+	if cmd.reverse {
+		less := cmp
+		cmp = func(a, b T) bool {
+			return less(b, a)
+		}
+	}
+	opts := []app.Option{app.WithMemoryLimit(cmd.memoryLimit), app.WithTempDir(cmd.tempDir), app.WithPreserveInputs(!cmd.inPlace)}
+	if cmd.concurrency > 0 {
+		opts = append(opts, app.WithConcurrency(cmd.concurrency))
+	}
+	if cmd.unique {
+		opts = append(opts, app.WithUnique(nil))
+	}
+
+	if len(cmd.inputs) == 0 {
+		// The standard input is a single reader, read by the streaming entry points
+		write := func(w io.Writer) error {
+			inputs := []io.Reader{cmd.stdin}
+			if cmd.merge {
+				return app.MergeStreams(inputs, w, parser, formatter, cmp, opts...)
+			}
+			return app.RunStreams(inputs, w, parser, formatter, cmp, opts...)
+		}
+		if cmd.output == stdio {
+			return write(cmd.stdout)
+		}
+		return writeFile(cmd.output, write)
+	}
+
+	// Expand the inputs before the run, so that an empty expansion is reported
+	inputFiles, err := app.ExpandInputs(cmd.inputs, cmd.expansion)
+	if err != nil {
+		return err
+	}
+	if len(inputFiles) == 0 {
+		return errors.New("no input files")
+	}
+	if cmd.output != stdio {
+		if cmd.merge {
+			return app.Merge(inputFiles, cmd.output, parser, formatter, cmp, opts...)
+		}
+		return app.Run(inputFiles, cmd.output, parser, formatter, cmp, opts...)
+	}
+
+	// Iterators open the input files as the merge needs them, within the maximum fan-in
+	var seq iter.Seq2[T, error]
+	if cmd.merge {
+		seq = app.MergeSeq(inputFiles, parser, formatter, cmp, opts...)
+	} else {
+		seq = app.RunSeq(inputFiles, parser, formatter, cmp, opts...)
+	}
+	w := bufio.NewWriter(cmd.stdout)
+	for val, err := range seq {
+		if err != nil {
+			return err
+		}
+		w.WriteString(formatter(val))
+		if err = w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// writeFile creates the file named name, writes it with write and closes it, removing the
+// partially written file if any of these fails.
+func writeFile(name string, write func(w io.Writer) error) error {
+	fd, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = write(fd)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
 }
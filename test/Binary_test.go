@@ -0,0 +1,269 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// record is a user-defined binary record layout sorted by its key.
+type record struct {
+	Key   uint32
+	Value int64
+	Flag  bool
+}
+
+// writeBinaryInputs writes each list of values as a file of binary records encoded with codec
+// and returns the paths of the files.
+func writeBinaryInputs[T any](t *testing.T, dir string, codec app.Codec[T], lists [][]T) []string {
+	t.Helper()
+	var files []string
+	for i, list := range lists {
+		var buf bytes.Buffer
+		record := make([]byte, codec.Size)
+		for _, val := range list {
+			codec.Encode(record, val)
+			buf.Write(record)
+		}
+		filename := filepath.Join(dir, "input_"+strconv.Itoa(i)+".bin")
+		if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		files = append(files, filename)
+	}
+	return files
+}
+
+// readBinaryOutput decodes the binary records of file with codec.
+func readBinaryOutput[T any](t *testing.T, file string, codec app.Codec[T]) []T {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if len(data)%codec.Size != 0 {
+		t.Fatalf("Output of %d bytes is not made of %d-byte records", len(data), codec.Size)
+	}
+	var values []T
+	for i := 0; i < len(data); i += codec.Size {
+		values = append(values, codec.Decode(data[i:i+codec.Size]))
+	}
+	return values
+}
+
+// TestRunBinary tests that fixed-size binary records of different types and byte orders are
+// sorted and merged, in inputs rewritten in place, in spilled runs, in intermediate passes and in
+// parallel merges.
+func TestRunBinary(t *testing.T) {
+	modes := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "in_place"},
+		{name: "with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(4 << 10), app.WithConcurrency(1)}},
+		{name: "read_only", opts: []app.Option{app.WithPreserveInputs(true)}},
+		{name: "with_passes", opts: []app.Option{app.WithMaxFanIn(2)}},
+		{name: "with_parallel_merge", opts: []app.Option{app.WithParallelMerge(4), app.WithReadBufferSize(100)}},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, mode := range modes {
+		t.Run("Test_int64_little_endian_"+mode.name, func(t *testing.T) {
+			lists := make([][]int64, 4)
+			var want []int64
+			for i := range lists {
+				for j := 0; j < 1000*i; j++ {
+					lists[i] = append(lists[i], rng.Int63n(1<<40)-1<<39)
+				}
+				want = append(want, lists[i]...)
+			}
+			slices.Sort(want)
+			codec := app.Int64Codec(binary.LittleEndian)
+			dataDir := t.TempDir()
+			inputFiles := writeBinaryInputs(t, dataDir, codec, lists)
+			outputFile := filepath.Join(dataDir, "out.bin")
+
+			opts := append([]app.Option{app.WithTempDir(t.TempDir())}, mode.opts...)
+			if err := app.RunBinary(inputFiles, outputFile, codec, func(a, b int64) bool { return a < b }, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+			if got := readBinaryOutput(t, outputFile, codec); !slices.Equal(got, want) {
+				t.Errorf("Output has %d values, want %d sorted values", len(got), len(want))
+			}
+		})
+
+		t.Run("Test_struct_big_endian_"+mode.name, func(t *testing.T) {
+			codec, err := app.StructCodec[record](binary.BigEndian)
+			if err != nil {
+				t.Fatalf("Failed to create codec: %v", err)
+			}
+			if codec.Size != 13 {
+				t.Errorf("Codec size = %d, want 13", codec.Size)
+			}
+			lists := make([][]record, 3)
+			var want []record
+			for i := range lists {
+				for j := 0; j < 700; j++ {
+					lists[i] = append(lists[i], record{Key: uint32(rng.Intn(100)), Value: int64(i*1000 + j), Flag: j%2 == 0})
+				}
+				want = append(want, lists[i]...)
+			}
+			cmp := func(a, b record) bool { return a.Key < b.Key }
+			slices.SortStableFunc(want, func(a, b record) int { return int(a.Key) - int(b.Key) })
+			dataDir := t.TempDir()
+			inputFiles := writeBinaryInputs(t, dataDir, codec, lists)
+			outputFile := filepath.Join(dataDir, "out.bin")
+
+			opts := append([]app.Option{app.WithTempDir(t.TempDir()), app.WithStable(true)}, mode.opts...)
+			if err = app.RunBinary(inputFiles, outputFile, codec, cmp, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+			if got := readBinaryOutput(t, outputFile, codec); !slices.Equal(got, want) {
+				t.Errorf("Output has %d records, want %d stably sorted records", len(got), len(want))
+			}
+		})
+	}
+}
+
+// TestMergeBinary tests that sorted binary records are merged as they are, with the codecs of
+// single numbers, and that unsorted inputs and partial records fail the merge.
+func TestMergeBinary(t *testing.T) {
+	dataDir := t.TempDir()
+
+	int32Codec := app.Int32Codec(binary.BigEndian)
+	files := writeBinaryInputs(t, dataDir, int32Codec, [][]int32{{-5, 0, 9}, {-7, 3}})
+	outputFile := filepath.Join(dataDir, "out_int32.bin")
+	if err := app.MergeBinary(files, outputFile, int32Codec, lessInt32); err != nil {
+		t.Fatalf("Failed to merge int32 records: %v", err)
+	}
+	if got := readBinaryOutput(t, outputFile, int32Codec); !slices.Equal(got, []int32{-7, -5, 0, 3, 9}) {
+		t.Errorf("Output = %v, want [-7 -5 0 3 9]", got)
+	}
+	data, _ := os.ReadFile(outputFile)
+	if want := []byte{0xff, 0xff, 0xff, 0xf9}; !bytes.HasPrefix(data, want) {
+		t.Errorf("Output starts with % x, want big-endian -7 % x", data[:4], want)
+	}
+
+	uint64Codec := app.Uint64Codec(binary.LittleEndian)
+	files = writeBinaryInputs(t, dataDir, uint64Codec, [][]uint64{{1, 1 << 63}, {2}})
+	outputFile = filepath.Join(dataDir, "out_uint64.bin")
+	if err := app.MergeBinary(files, outputFile, uint64Codec, func(a, b uint64) bool { return a < b }, app.WithUnique(nil)); err != nil {
+		t.Fatalf("Failed to merge uint64 records: %v", err)
+	}
+	if got := readBinaryOutput(t, outputFile, uint64Codec); !slices.Equal(got, []uint64{1, 2, 1 << 63}) {
+		t.Errorf("Output = %v, want [1 2 %d]", got, uint64(1<<63))
+	}
+
+	float64Codec := app.Float64Codec(binary.LittleEndian)
+	files = writeBinaryInputs(t, dataDir, float64Codec, [][]float64{{-1.5, 2.25}, {0.5, 0.75}})
+	outputFile = filepath.Join(dataDir, "out_float64.bin")
+	if err := app.MergeBinary(files, outputFile, float64Codec, func(a, b float64) bool { return a < b }); err != nil {
+		t.Fatalf("Failed to merge float64 records: %v", err)
+	}
+	if got := readBinaryOutput(t, outputFile, float64Codec); !slices.Equal(got, []float64{-1.5, 0.5, 0.75, 2.25}) {
+		t.Errorf("Output = %v, want [-1.5 0.5 0.75 2.25]", got)
+	}
+
+	// An unsorted input is reported with its record number and values
+	files = writeBinaryInputs(t, dataDir, float64Codec, [][]float64{{1, 3, 2}})
+	err := app.MergeBinary(files, filepath.Join(dataDir, "out_unsorted.bin"), float64Codec, func(a, b float64) bool { return a < b })
+	if err == nil || !strings.Contains(err.Error(), "record 3") || !strings.Contains(err.Error(), "2") {
+		t.Errorf("Merge of unsorted records returned %v, want an error for record 3", err)
+	}
+
+	// An input ending with a partial record is an error
+	partial := filepath.Join(dataDir, "partial.bin")
+	if err = os.WriteFile(partial, []byte{1, 0, 0, 0, 2, 0}, 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	err = app.MergeBinary([]string{partial}, filepath.Join(dataDir, "out_partial.bin"), app.Int32Codec(binary.LittleEndian), lessInt32)
+	if err == nil || !strings.Contains(err.Error(), "partial record") {
+		t.Errorf("Merge of a partial record returned %v, want a partial record error", err)
+	}
+}
+
+// TestBinaryMagicBytes tests that binary records starting like a gzip header are read as they
+// are by default, in place, in spilled runs and in parallel merges, while inputs named like
+// compressed files and explicitly requested detection are still decompressed.
+func TestBinaryMagicBytes(t *testing.T) {
+	// 559903 is 1f 8b 08 00 in little-endian, the start of a gzip stream
+	codec := app.Int32Codec(binary.LittleEndian)
+	lists := [][]int32{{559903, 7, -1}, {559903, 3}}
+	want := []int32{-1, 3, 7, 559903, 559903}
+
+	modes := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "in_place"},
+		{name: "with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(4), app.WithConcurrency(1)}},
+		{name: "with_parallel_merge", opts: []app.Option{app.WithParallelMerge(2)}},
+	}
+	for _, mode := range modes {
+		t.Run("Test_run_"+mode.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			inputFiles := writeBinaryInputs(t, dataDir, codec, lists)
+			outputFile := filepath.Join(dataDir, "out.bin")
+			opts := append([]app.Option{app.WithTempDir(t.TempDir())}, mode.opts...)
+			if err := app.RunBinary(inputFiles, outputFile, codec, lessInt32, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+			if got := readBinaryOutput(t, outputFile, codec); !slices.Equal(got, want) {
+				t.Errorf("Output = %v, want %v", got, want)
+			}
+
+			sortedFiles := writeBinaryInputs(t, t.TempDir(), codec, [][]int32{{559903, 600000}, {-1, 3}})
+			if err := app.MergeBinary(sortedFiles, outputFile, codec, lessInt32, mode.opts...); err != nil {
+				t.Fatalf("Failed to merge binary records: %v", err)
+			}
+			if got := readBinaryOutput(t, outputFile, codec); !slices.Equal(got, []int32{-1, 3, 559903, 600000}) {
+				t.Errorf("Output = %v, want [-1 3 559903 600000]", got)
+			}
+		})
+	}
+
+	t.Run("Test_compressed_by_extension", func(t *testing.T) {
+		dataDir := t.TempDir()
+		sorted := writeBinaryInputs(t, dataDir, codec, [][]int32{{-1, 559903}})
+		content, _ := os.ReadFile(sorted[0])
+		gz := filepath.Join(dataDir, "sorted.bin.gz")
+		if err := os.WriteFile(gz, gzipData(string(content)), 0644); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		outputFile := filepath.Join(dataDir, "out.bin")
+		if err := app.MergeBinary([]string{gz}, outputFile, codec, lessInt32); err != nil {
+			t.Fatalf("Failed to merge binary records: %v", err)
+		}
+		if got := readBinaryOutput(t, outputFile, codec); !slices.Equal(got, []int32{-1, 559903}) {
+			t.Errorf("Output = %v, want [-1 559903]", got)
+		}
+
+		// Detection from the first bytes can still be requested
+		plain := filepath.Join(dataDir, "sorted.dat")
+		if err := os.WriteFile(plain, gzipData(string(content)), 0644); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		if err := app.MergeBinary([]string{plain}, outputFile, codec, lessInt32, app.WithInputCompression(app.CompressionAuto)); err != nil {
+			t.Fatalf("Failed to merge binary records: %v", err)
+		}
+		if got := readBinaryOutput(t, outputFile, codec); !slices.Equal(got, []int32{-1, 559903}) {
+			t.Errorf("Output = %v, want [-1 559903]", got)
+		}
+	})
+}
+
+// TestStructCodecSize tests that types without a fixed binary size are rejected.
+func TestStructCodecSize(t *testing.T) {
+	if _, err := app.StructCodec[struct{ Name string }](binary.LittleEndian); err == nil {
+		t.Error("StructCodec accepted a struct with a string field")
+	}
+	if _, err := app.StructCodec[[]int32](binary.LittleEndian); err == nil {
+		t.Error("StructCodec accepted a slice")
+	}
+}
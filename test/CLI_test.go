@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCommand tests the kwaymerger command: its value types and flags, reading the standard
+// input and writing the standard output, and its exit statuses.
+func TestCommand(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "kwaymerger")
+	if out, err := exec.Command("go", "build", "-o", bin, "KWayMerger").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build command: %v\n%s", err, out)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		files     map[string]string // Input files, written to the working directory
+		stdin     string
+		want      string // Standard output, or the content of output when set
+		output    string
+		wantFiles map[string]string // Contents of input files after the run, if different
+		wantCode  int
+	}{
+		{
+			name:  "Test_files_to_output_file",
+			args:  []string{"-type", "int32", "a.txt", "b.txt", "out.txt"},
+			files: map[string]string{"a.txt": "10 2\n9\n", "b.txt": "1 30 2\n"},
+			want:  "1\n2\n2\n9\n10\n30\n", output: "out.txt",
+		},
+		{
+			name:  "Test_in_place",
+			args:  []string{"-type", "int32", "-in-place", "a.txt", "b.txt", "out.txt"},
+			files: map[string]string{"a.txt": "10 2\n9\n", "b.txt": "1 30 2\n"},
+			want:  "1\n2\n2\n9\n10\n30\n", output: "out.txt",
+			wantFiles: map[string]string{"a.txt": "2\n9\n10\n", "b.txt": "1\n2\n30\n"},
+		},
+		{
+			name:  "Test_directory_to_stdout",
+			args:  []string{"-recursive", "-u", "-o", "-", "shards"},
+			files: map[string]string{"shards/a.txt": "b a\n", "shards/x/b.txt": "c a\n", "shards/x/y/c.txt": "d\n"},
+			want:  "a\nb\nc\nd\n",
+		},
+		{
+			name:  "Test_stdin_to_stdout",
+			stdin: "pear apple fig\n",
+			want:  "apple\nfig\npear\n",
+		},
+		{
+			name:  "Test_reverse_unique_floats",
+			args:  []string{"-type", "float64", "-r", "-u", "-o", "-"},
+			stdin: "3 1.5 NaN 3 -Inf 1e3\n",
+			want:  "1000\n3\n1.5\n-Inf\nNaN\n",
+		},
+		{
+			name:  "Test_files_to_stdout_with_spilled_runs",
+			args:  []string{"-type", "uint64", "-concurrency", "1", "-memory", "8", "-tempdir", ".", "-o", "-", "a.txt", "b.txt"},
+			files: map[string]string{"a.txt": "18446744073709551615 7\n", "b.txt": "0 42\n"},
+			want:  "0\n7\n42\n18446744073709551615\n",
+		},
+		{
+			name:  "Test_stdin_to_output_file",
+			args:  []string{"-type", "int64", "-o", "out.txt"},
+			stdin: "-5 9223372036854775807 0\n",
+			want:  "-5\n0\n9223372036854775807\n", output: "out.txt",
+		},
+		{
+			name:  "Test_merge_reverse",
+			args:  []string{"-merge", "-reverse", "-o", "-", "a.txt", "b.txt"},
+			files: map[string]string{"a.txt": "c a\n", "b.txt": "d b\n"},
+			want:  "d\nc\nb\na\n",
+		},
+		{
+			name:     "Test_merge_unsorted",
+			args:     []string{"-merge", "-o", "-", "a.txt"},
+			files:    map[string]string{"a.txt": "b a\n"},
+			wantCode: 3,
+		},
+		{
+			name:     "Test_invalid_value",
+			args:     []string{"-type", "int32", "-o", "out.txt"},
+			stdin:    "1 x\n",
+			wantCode: 1,
+		},
+		{
+			name:     "Test_missing_input",
+			args:     []string{"missing.txt", "out.txt"},
+			wantCode: 1,
+		},
+		{
+			name:     "Test_unknown_type",
+			args:     []string{"-type", "int8"},
+			wantCode: 2,
+		},
+		{
+			name:     "Test_missing_output",
+			args:     []string{"a.txt"},
+			wantCode: 2,
+		},
+		{
+			name:     "Test_unknown_flag",
+			args:     []string{"-bogus"},
+			wantCode: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(bin, tt.args...)
+			cmd.Dir = dir
+			cmd.Stdin = strings.NewReader(tt.stdin)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			err := cmd.Run()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatalf("Failed to run command: %v", err)
+			}
+			if code != tt.wantCode {
+				t.Fatalf("Exit status = %d, want %d\n%s", code, tt.wantCode, stderr.String())
+			}
+			if tt.wantCode != 0 {
+				if stderr.Len() == 0 {
+					t.Error("Failed command wrote nothing to the standard error")
+				}
+				if _, err := os.Stat(filepath.Join(dir, "out.txt")); !os.IsNotExist(err) {
+					t.Error("Failed command left the output file behind")
+				}
+				return
+			}
+
+			got := stdout.String()
+			if tt.output != "" {
+				content, err := os.ReadFile(filepath.Join(dir, tt.output))
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				got = string(content)
+			}
+			if got != tt.want {
+				t.Errorf("Output = %q, want %q", got, tt.want)
+			}
+
+			// Input files are left unmodified unless rewritten in place
+			for name, content := range tt.files {
+				if want, ok := tt.wantFiles[name]; ok {
+					content = want
+				}
+				got, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if string(got) != content {
+					t.Errorf("Input %s = %q, want %q", name, got, content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunCSV tests that CSV and TSV rows are sorted by their key columns and written back
+// unchanged, with quoted fields containing newlines and bare quotes inside fields, and that the header is kept once at the
+// top of the output, in inputs rewritten in place, in spilled runs and in intermediate passes.
+func TestRunCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		comma    rune
+		quoting  app.CSVQuoting
+		columns  []int
+		header   bool
+		contents []string
+		want     string
+	}{
+		{
+			name:     "Test_CSV_with_header",
+			comma:    ',',
+			columns:  []int{1},
+			header:   true,
+			contents: []string{"id,name\n3,carol\n1,\"alice, a\"\n", "id,name\r\n2,\"bob\nsmith\"\r\n", "id,name\n4,dave\n"},
+			want:     "id,name\n1,\"alice, a\"\n2,\"bob\nsmith\"\n3,carol\n4,dave\n",
+		},
+		{
+			name:     "Test_TSV_with_header",
+			comma:    '\t',
+			columns:  []int{0},
+			header:   true,
+			contents: []string{"name\tcity\nzoe\tparis\nann\toslo\n", "name\tcity\nbob\trome\n", "name\tcity\n"},
+			want:     "name\tcity\nann\toslo\nbob\trome\nzoe\tparis\n",
+		},
+		{
+			name:     "Test_CSV_with_quotes_inside_fields",
+			comma:    ',',
+			columns:  []int{1},
+			contents: []string{"5 inch\",b\n\"q\"\"d\",a\n", "x,\"c\nd\"\n"},
+			want:     "\"q\"\"d\",a\n5 inch\",b\nx,\"c\nd\"\n",
+		},
+		{
+			name:     "Test_TSV_with_bare_quote",
+			comma:    '\t',
+			columns:  []int{1},
+			contents: []string{"5 inch\"\tb\nz\ta\n", "y\t\"c\td\"\n"},
+			want:     "z\ta\n5 inch\"\tb\ny\t\"c\td\"\n",
+		},
+		{
+			name:     "Test_TSV_without_quoting",
+			comma:    '\t',
+			quoting:  app.CSVNoQuotes,
+			columns:  []int{1},
+			contents: []string{"5 inch\"\tb\n\"x\tc\n", "a\"b\"\ta\n"},
+			want:     "a\"b\"\ta\n5 inch\"\tb\n\"x\tc\n",
+		},
+		{
+			name:     "Test_CSV_with_several_key_columns",
+			comma:    ',',
+			columns:  []int{2, 0},
+			contents: []string{"b,x,2\na,y,2\n", "c,z,1\n\"a\"\"q\",w,2", "b,w\n"},
+			want:     "b,w\nc,z,1\na,y,2\n\"a\"\"q\",w,2\nb,x,2\n",
+		},
+	}
+	modes := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "in_place"},
+		{name: "with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(40), app.WithConcurrency(1)}},
+		{name: "with_passes", opts: []app.Option{app.WithMaxFanIn(2), app.WithParallelMerge(2)}},
+	}
+	for _, tt := range tests {
+		for _, mode := range modes {
+			t.Run(tt.name+"_"+mode.name, func(t *testing.T) {
+				dataDir := t.TempDir()
+				inputFiles := writeInputs(t, dataDir, ".csv", tt.contents)
+				outputFile := filepath.Join(dataDir, "out.csv")
+
+				opts := append([]app.Option{app.WithCSV(tt.comma, tt.quoting), app.WithTempDir(t.TempDir())}, mode.opts...)
+				if tt.header {
+					opts = append(opts, app.WithHeader())
+				}
+				if err := app.Run(inputFiles, outputFile, app.ParseCSV(tt.comma, tt.quoting), app.FormatCSV, app.CompareCSVColumns(tt.columns...), opts...); err != nil {
+					t.Fatalf("Failed to run K-Way Merger: %v", err)
+				}
+
+				got, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("Output = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestMergeStreamsCSVHeader tests that the header of sorted CSV streams is written once, also
+// when the streams hold no rows, and that it is not returned by iterators.
+func TestMergeStreamsCSVHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents []string
+		want     string
+	}{
+		{name: "Test_with_rows", contents: []string{"k,v\na,1\nc,3\n", "k,v\nb,2\n"}, want: "k,v\na,1\nb,2\nc,3\n"},
+		{name: "Test_header_only", contents: []string{"k,v\n", "k,v\n"}, want: "k,v\n"},
+		{name: "Test_empty", contents: []string{"", ""}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inputs []io.Reader
+			for _, content := range tt.contents {
+				inputs = append(inputs, strings.NewReader(content))
+			}
+			var out bytes.Buffer
+			if err := app.MergeStreams(inputs, &out, app.ParseCSV(',', app.CSVQuotes), app.FormatCSV, app.CompareCSVColumns(0), app.WithCSV(',', app.CSVQuotes), app.WithHeader()); err != nil {
+				t.Fatalf("Failed to merge streams: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+
+	var rows []string
+	seq := app.MergeSeq([]string{writeTempFile(t, "k,v\nb,2\n"), writeTempFile(t, "k,v\na,1\n")},
+		app.ParseCSV(',', app.CSVQuotes), app.FormatCSV, app.CompareCSVColumns(0), app.WithCSV(',', app.CSVQuotes), app.WithHeader())
+	for rec, err := range seq {
+		if err != nil {
+			t.Fatalf("Failed to merge: %v", err)
+		}
+		rows = append(rows, rec.Row)
+	}
+	if got := strings.Join(rows, "|"); got != "a,1|b,2" {
+		t.Errorf("Rows = %q, want %q", got, "a,1|b,2")
+	}
+}
+
+// TestRunCSVHeaderPerInput tests that each input keeps its own header when rewritten in place,
+// that empty inputs get none, and that the output header is that of the first input with a
+// header, whichever input is sorted first, also through spilled runs, passes and parallel merges.
+func TestRunCSVHeaderPerInput(t *testing.T) {
+	contents := []string{"id\tname\n2\tb\n1\ta\n", "ID\tNAME\n4\td\n3\tc\n", "", "id\tname\n"}
+	rows := "1\ta\n2\tb\n3\tc\n4\td\n"
+	tests := []struct {
+		name      string
+		order     []int // Indices of contents in the order of the inputs
+		opts      []app.Option
+		want      string
+		wantFiles []string // Contents of the inputs after the run, in the order of contents
+	}{
+		{
+			name:      "Test_in_place",
+			order:     []int{0, 1, 2, 3},
+			opts:      []app.Option{app.WithPreserveInputs(false)},
+			want:      "id\tname\n" + rows,
+			wantFiles: []string{"id\tname\n1\ta\n2\tb\n", "ID\tNAME\n3\tc\n4\td\n", "", "id\tname\n"},
+		},
+		{
+			name:  "Test_spilled_runs_after_empty_input",
+			order: []int{2, 1, 0, 3},
+			opts:  []app.Option{app.WithPreserveInputs(true), app.WithMemoryLimit(1)},
+			want:  "ID\tNAME\n" + rows,
+		},
+		{
+			name:  "Test_header_only_input_with_passes",
+			order: []int{3, 1, 0, 2},
+			opts:  []app.Option{app.WithPreserveInputs(true), app.WithMaxFanIn(2)},
+			want:  "id\tname\n" + rows,
+		},
+		{
+			name:      "Test_parallel_merge",
+			order:     []int{2, 1, 0, 3},
+			opts:      []app.Option{app.WithPreserveInputs(false), app.WithParallelMerge(4)},
+			want:      "ID\tNAME\n" + rows,
+			wantFiles: []string{"id\tname\n1\ta\n2\tb\n", "ID\tNAME\n3\tc\n4\td\n", "", "id\tname\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sort the inputs concurrently several times, so that they finish in different orders
+			for range 10 {
+				dir := t.TempDir()
+				files := writeInputs(t, dir, ".tsv", contents)
+				var inputFiles []string
+				for _, i := range tt.order {
+					inputFiles = append(inputFiles, files[i])
+				}
+				outputFile := filepath.Join(dir, "output.tsv")
+				opts := append([]app.Option{app.WithCSV('\t', app.CSVNoQuotes), app.WithHeader(), app.WithConcurrency(4)}, tt.opts...)
+				if err := app.Run(inputFiles, outputFile, app.ParseCSV('\t', app.CSVNoQuotes), app.FormatCSV, app.CompareCSVColumns(0), opts...); err != nil {
+					t.Fatalf("Failed to run: %v", err)
+				}
+				got, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if string(got) != tt.want {
+					t.Fatalf("Output = %q, want %q", got, tt.want)
+				}
+
+				wantFiles := tt.wantFiles
+				if wantFiles == nil {
+					wantFiles = contents
+				}
+				for i, file := range files {
+					got, _ := os.ReadFile(file)
+					if string(got) != wantFiles[i] {
+						t.Fatalf("Input %s = %q, want %q", filepath.Base(file), got, wantFiles[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// writeTempFile writes content to a new file in a temporary directory and returns its path.
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	fd, err := os.CreateTemp(t.TempDir(), "input_*.csv")
+	if err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+	defer fd.Close()
+	if _, err = fd.WriteString(content); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	return fd.Name()
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bzip2Data is "9 1 5\n" compressed with bzip2, which the standard library cannot write.
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xa8, 0x4b,
+	0x9d, 0xe7, 0x00, 0x00, 0x02, 0xd8, 0x00, 0x00, 0x10, 0x40, 0x00, 0x22,
+	0x20, 0x20, 0x00, 0x30, 0xcd, 0x00, 0xc1, 0xa6, 0x01, 0x1c, 0x5d, 0xc9,
+	0x14, 0xe1, 0x42, 0x42, 0xa1, 0x2e, 0x77, 0x9c,
+}
+
+// gzipData returns s compressed with gzip.
+func gzipData(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+// zlibData returns s compressed with zlib.
+func zlibData(s string) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(s))
+	zw.Close()
+	return buf.Bytes()
+}
+
+// TestRunCompressed tests that compressed inputs are detected by their extension or magic bytes
+// and decompressed, that they are never rewritten, that plain inputs resembling a compressed
+// stream are read as they are, and that the output is compressed as requested.
+func TestRunCompressed(t *testing.T) {
+	inputs := []struct {
+		name    string
+		content []byte
+	}{
+		{name: "a.txt.gz", content: gzipData("8 3\n")},
+		{name: "b.gz.part", content: gzipData("2 10\n")},
+		{name: "c.zz", content: zlibData("4\n")},
+		{name: "d", content: zlibData("7 0\n")},
+		{name: "e.bz2", content: bzip2Data},
+		{name: "f.dat", content: bzip2Data},
+		{name: "g.txt", content: []byte("6\n")},
+	}
+	tests := []struct {
+		name       string
+		output     string
+		opts       []app.Option
+		decompress func(io.Reader) (io.Reader, error)
+	}{
+		{name: "Test_plain_output", output: "out.txt"},
+		{name: "Test_gzip_output_by_extension", output: "out.txt.gz", opts: []app.Option{app.WithOutputCompression(app.CompressionAuto)},
+			decompress: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{name: "Test_zlib_output", output: "out", opts: []app.Option{app.WithOutputCompression(app.CompressionZlib)},
+			decompress: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{name: "Test_with_spilled_runs", output: "out.txt", opts: []app.Option{app.WithMemoryLimit(16), app.WithConcurrency(1)}},
+		{name: "Test_with_parallel_merge", output: "out.txt", opts: []app.Option{app.WithParallelMerge(4), app.WithMaxFanIn(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			var inputFiles []string
+			for _, input := range inputs {
+				filename := filepath.Join(dataDir, input.name)
+				if err := os.WriteFile(filename, input.content, 0644); err != nil {
+					t.Fatalf("Failed to write input file: %v", err)
+				}
+				inputFiles = append(inputFiles, filename)
+			}
+			outputFile := filepath.Join(dataDir, tt.output)
+
+			opts := append([]app.Option{app.WithTempDir(t.TempDir())}, tt.opts...)
+			if err := app.Run(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			fd, err := os.Open(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to open output file: %v", err)
+			}
+			defer fd.Close()
+			var r io.Reader = fd
+			if tt.decompress != nil {
+				if r, err = tt.decompress(fd); err != nil {
+					t.Fatalf("Failed to decompress output file: %v", err)
+				}
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if want := "0\n1\n1\n2\n3\n4\n5\n5\n6\n7\n8\n9\n9\n10\n"; string(got) != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+
+			// Compressed inputs are left as they are
+			for i, input := range inputs[:len(inputs)-1] {
+				content, _ := os.ReadFile(inputFiles[i])
+				if !bytes.Equal(content, input.content) {
+					t.Errorf("Compressed input %s was rewritten", input.name)
+				}
+			}
+		})
+	}
+}
+
+// TestMergeCompressed tests that sorted compressed files and readers are merged, that plain
+// text starting like a zlib header is not mistaken for one, and that detection can be disabled.
+func TestMergeCompressed(t *testing.T) {
+	dataDir := t.TempDir()
+	gz := filepath.Join(dataDir, "a.gz")
+	plain := filepath.Join(dataDir, "b.txt")
+	if err := os.WriteFile(gz, gzipData("x^a\nx^c\n"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	if err := os.WriteFile(plain, []byte("x^b\n"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	outputFile := filepath.Join(dataDir, "out.txt")
+	if err := app.Merge([]string{gz, plain}, outputFile, parseString, formatString, lessString, app.WithParallelMerge(2)); err != nil {
+		t.Fatalf("Failed to merge files: %v", err)
+	}
+	got, _ := os.ReadFile(outputFile)
+	if want := "x^a\nx^b\nx^c\n"; string(got) != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+
+	var out bytes.Buffer
+	inputs := []io.Reader{bytes.NewReader(gzipData("a c\n")), strings.NewReader("b\n"), bytes.NewReader(zlibData("d\n"))}
+	if err := app.MergeStreams(inputs, &out, parseString, formatString, lessString); err != nil {
+		t.Fatalf("Failed to merge streams: %v", err)
+	}
+	if want := "a\nb\nc\nd\n"; out.String() != want {
+		t.Errorf("Output = %q, want %q", out.String(), want)
+	}
+
+	// Without detection the compressed bytes are read as they are
+	out.Reset()
+	inputs = []io.Reader{bytes.NewReader(gzipData("a\n"))}
+	err := app.MergeStreams(inputs, &out, parseString, formatString, lessString, app.WithInputCompression(app.CompressionNone))
+	if err == nil && out.String() == "a\n" {
+		t.Error("Input was decompressed with CompressionNone")
+	}
+
+	// Output cannot be compressed with bzip2
+	err = app.Merge([]string{plain}, filepath.Join(dataDir, "out.bz2"), parseString, formatString, lessString, app.WithOutputCompression(app.CompressionAuto))
+	if err == nil {
+		t.Error("Merge into a bzip2 output file succeeded, want an error")
+	}
+	if _, statErr := os.Stat(filepath.Join(dataDir, "out.bz2")); !os.IsNotExist(statErr) {
+		t.Error("Failed merge left the output file behind")
+	}
+}
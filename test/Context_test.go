@@ -0,0 +1,70 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// TestRunContext tests that canceling the context aborts a run, removes the partial
+// output file, and never loses values of the input files.
+func TestRunContext(t *testing.T) {
+	tests := []struct {
+		name        string
+		cancelAfter int64 // Number of parsed values after which the context is canceled
+	}{
+		{name: "Test_with_canceled_context", cancelAfter: 0},
+		{name: "Test_with_cancel_during_sort", cancelAfter: 5000},
+		{name: "Test_with_cancel_during_merge", cancelAfter: 45000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			inputFiles, want, err := generateInt32Inputs(dataDir, 4, 10000)
+			if err != nil {
+				t.Fatalf("Failed to generate input files: %v", err)
+			}
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelAfter == 0 {
+				cancel()
+			}
+			var parsed atomic.Int64
+			parse := func(s string) (int32, error) {
+				if parsed.Add(1) == tt.cancelAfter {
+					cancel()
+				}
+				return parseInt32(s)
+			}
+
+			err = app.RunContext(ctx, inputFiles, outputFile, parse, formatInt32, lessInt32)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Run error = %v, want %v", err, context.Canceled)
+			}
+			if _, statErr := os.Stat(outputFile); !os.IsNotExist(statErr) {
+				t.Errorf("Output file exists after canceled run, stat error = %v", statErr)
+			}
+
+			// Inputs may have been sorted in place, but must still hold all values
+			var got []int32
+			for _, file := range inputFiles {
+				values, err := readInt32s(file)
+				if err != nil {
+					t.Fatalf("Failed to read input file: %v", err)
+				}
+				got = append(got, values...)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("Inputs have %d values after canceled run, want %d", len(got), len(want))
+			}
+		})
+	}
+}
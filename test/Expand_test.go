@@ -0,0 +1,162 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeTree writes files with the given contents at the given slash-separated paths below dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+// TestExpandInputs tests that glob patterns and directories are expanded into files in a
+// deterministic order, recursively if requested, with hidden and excluded files skipped.
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"shards/b.txt":         "",
+		"shards/a.txt":         "",
+		"shards/c.log":         "",
+		"shards/.hidden.txt":   "",
+		"shards/sub/d.txt":     "",
+		"shards/sub/.git/x":    "",
+		"shards/.cache/e.txt":  "",
+		"shards/skip/f.txt":    "",
+		"other/g.txt":          "",
+		"other/h.txt":          "",
+		"other/nested/i.txt":   "",
+		"other/nested/j.other": "",
+	})
+	path := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		inputs  []string
+		exp     app.InputExpansion
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "Test_directory",
+			inputs: path("shards"),
+			want:   path("shards/a.txt", "shards/b.txt", "shards/c.log"),
+		},
+		{
+			name:   "Test_recursive_directory",
+			inputs: path("shards"),
+			exp:    app.InputExpansion{Recursive: true},
+			want:   path("shards/a.txt", "shards/b.txt", "shards/c.log", "shards/skip/f.txt", "shards/sub/d.txt"),
+		},
+		{
+			name:   "Test_include_and_exclude",
+			inputs: path("shards"),
+			exp:    app.InputExpansion{Recursive: true, Include: []string{"*.txt"}, Exclude: []string{"skip", "b.*"}},
+			want:   path("shards/a.txt", "shards/sub/d.txt"),
+		},
+		{
+			name:   "Test_hidden",
+			inputs: path("shards"),
+			exp:    app.InputExpansion{Recursive: true, Hidden: true, Exclude: []string{"skip"}},
+			want:   path("shards/.cache/e.txt", "shards/.hidden.txt", "shards/a.txt", "shards/b.txt", "shards/c.log", "shards/sub/.git/x", "shards/sub/d.txt"),
+		},
+		{
+			name:   "Test_glob_patterns_in_input_order",
+			inputs: append(path("other/*.txt"), path("shards/*.txt", "other/g.txt")...),
+			want:   path("other/g.txt", "other/h.txt", "shards/a.txt", "shards/b.txt"),
+		},
+		{
+			name:   "Test_glob_matching_directories",
+			inputs: path("*"),
+			exp:    app.InputExpansion{Include: []string{"*.txt"}},
+			want:   path("other/g.txt", "other/h.txt", "shards/a.txt", "shards/b.txt"),
+		},
+		{
+			name:   "Test_literal_files_are_kept",
+			inputs: path("shards/.hidden.txt", "shards/c.log", "missing.txt"),
+			exp:    app.InputExpansion{Include: []string{"*.txt"}},
+			want:   path("shards/.hidden.txt", "shards/c.log", "missing.txt"),
+		},
+		{
+			name:    "Test_pattern_without_matches",
+			inputs:  path("shards/*.csv"),
+			wantErr: true,
+		},
+		{
+			name:    "Test_invalid_pattern",
+			inputs:  path("shards"),
+			exp:     app.InputExpansion{Exclude: []string{"[a"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := app.ExpandInputs(tt.inputs, tt.exp)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ExpandInputs() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to expand inputs: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ExpandInputs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunInputExpansion tests that runs and merges expand their inputs before reading them.
+func TestRunInputExpansion(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"shards/part-1.txt":      "5 1\n",
+		"shards/part-2.txt":      "4\n",
+		"shards/2024/part-3.txt": "3 2\n",
+		"shards/.tmp/part-4.txt": "0\n",
+		"shards/README":          "not a shard\n",
+	})
+	exp := app.WithInputExpansion(app.InputExpansion{Recursive: true, Include: []string{"part-*"}})
+
+	outputFile := filepath.Join(dir, "out.txt")
+	if err := app.Run([]string{filepath.Join(dir, "shards")}, outputFile, parseInt32, formatInt32, lessInt32, exp); err != nil {
+		t.Fatalf("Failed to run K-Way Merger: %v", err)
+	}
+	got, _ := os.ReadFile(outputFile)
+	if want := "1\n2\n3\n4\n5\n"; string(got) != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+
+	// The inputs were sorted in place, so they can be merged
+	if err := app.Merge([]string{filepath.Join(dir, "shards", "*")}, outputFile, parseInt32, formatInt32, lessInt32, exp); err != nil {
+		t.Fatalf("Failed to merge files: %v", err)
+	}
+	got, _ = os.ReadFile(outputFile)
+	if want := "1\n2\n3\n4\n5\n"; string(got) != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+
+	if err := app.Merge([]string{filepath.Join(dir, "*.csv")}, outputFile, parseInt32, formatInt32, lessInt32, exp); err == nil {
+		t.Error("Merge of a pattern without matches succeeded, want an error")
+	}
+}
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// readInt32s reads all int32 values from the specified file in order.
+func readInt32s(filename string) ([]int32, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	scanner.Split(bufio.ScanWords) // Split on whitespace
+	var list []int32
+	for scanner.Scan() {
+		val, err := strconv.ParseInt(scanner.Text(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse number in file %s: %w", filename, err)
+		}
+		list = append(list, int32(val))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", filename, err)
+	}
+	return list, nil
+}
+
+// generateInt32Inputs creates n files of count random int32 values in dir and
+// returns their paths together with all generated values in sorted order.
+func generateInt32Inputs(dir string, n, count int) ([]string, []int32, error) {
+	var inputFiles []string
+	var want []int32
+	for i := 1; i <= n; i++ {
+		filename := filepath.Join(dir, "input_"+strconv.Itoa(i)+".txt")
+		if err := generateRandomNumberInt32(filename, count); err != nil {
+			return nil, nil, err
+		}
+		values, err := readInt32s(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		inputFiles = append(inputFiles, filename)
+		want = append(want, values...)
+	}
+	slices.Sort(want)
+	return inputFiles, want, nil
+}
+
+// writeInputs writes each of contents to a file named input_a, input_b and so on with the
+// extension ext in dir, and returns the paths of the files.
+func writeInputs(t *testing.T, dir, ext string, contents []string) []string {
+	t.Helper()
+	var inputFiles []string
+	for i, content := range contents {
+		filename := filepath.Join(dir, "input_"+string(rune('a'+i))+ext)
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		inputFiles = append(inputFiles, filename)
+	}
+	return inputFiles
+}
+
+// parseInt32, formatInt32 and lessInt32 are the int32 callbacks shared by the tests.
+func parseInt32(s string) (int32, error) {
+	val, err := strconv.ParseInt(s, 10, 32)
+	return int32(val), err
+}
+
+func formatInt32(i int32) string {
+	return strconv.FormatInt(int64(i), 10)
+}
+
+func lessInt32(a, b int32) bool {
+	return a < b
+}
+
+// parseString, formatString and lessString are the string callbacks shared by the tests.
+func parseString(s string) (string, error) {
+	return s, nil
+}
+
+func formatString(s string) string {
+	return s
+}
+
+func lessString(a, b string) bool {
+	return a < b
+}
+
+// TestRunWithMemoryLimit tests that inputs larger than the memory limit are sorted
+// through spilled runs and that the spill directory is cleaned up afterwards.
+func TestRunWithMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		memoryLimit int64
+	}{
+		{name: "Test_without_limit", memoryLimit: 0},
+		{name: "Test_with_large_limit", memoryLimit: 64 << 20},
+		{name: "Test_with_small_limit", memoryLimit: 64 << 10},
+		{name: "Test_with_tiny_limit", memoryLimit: 4 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			spillDir := t.TempDir()
+			inputFiles, want, err := generateInt32Inputs(dataDir, 4, 5000)
+			if err != nil {
+				t.Fatalf("Failed to generate input files: %v", err)
+			}
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			err = app.RunWithMemoryLimit(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, tt.memoryLimit, spillDir)
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := readInt32s(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("Output has %d values, want the %d sorted input values", len(got), len(want))
+			}
+			entries, err := os.ReadDir(spillDir)
+			if err != nil {
+				t.Fatalf("Failed to read spill directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Spill directory has %d entries after the run, want 0", len(entries))
+			}
+		})
+	}
+}
+
+// TestRunReadOnly tests that read-only runs leave the input files byte-identical and
+// remove their temporary files, both on success and on error.
+func TestRunReadOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		memoryLimit int64
+		corrupt     bool
+	}{
+		{name: "Test_without_limit", memoryLimit: 0},
+		{name: "Test_with_small_limit", memoryLimit: 16 << 10},
+		{name: "Test_with_invalid_input", memoryLimit: 16 << 10, corrupt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			tempDir := t.TempDir()
+			inputFiles, want, err := generateInt32Inputs(dataDir, 3, 5000)
+			if err != nil {
+				t.Fatalf("Failed to generate input files: %v", err)
+			}
+			if tt.corrupt {
+				fd, err := os.OpenFile(inputFiles[2], os.O_WRONLY|os.O_APPEND, 0644)
+				if err != nil {
+					t.Fatalf("Failed to open input file: %v", err)
+				}
+				fmt.Fprintln(fd, "not-a-number")
+				fd.Close()
+			}
+			var originals [][]byte
+			for _, file := range inputFiles {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("Failed to read input file: %v", err)
+				}
+				originals = append(originals, content)
+			}
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			err = app.RunReadOnly(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, tt.memoryLimit, tempDir)
+			if tt.corrupt {
+				if err == nil {
+					t.Fatalf("Expected an error for invalid input, got nil")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Failed to run K-Way Merger: %v", err)
+				}
+				got, err := readInt32s(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("Output has %d values, want the %d sorted input values", len(got), len(want))
+				}
+			}
+
+			for i, file := range inputFiles {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("Failed to read input file: %v", err)
+				}
+				if !bytes.Equal(content, originals[i]) {
+					t.Errorf("Input file %s was modified", file)
+				}
+			}
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to read temporary directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Temporary directory has %d entries after the run, want 0", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMergeWithMaxFanIn tests that merges of more files than the maximum fan-in run in
+// several passes, produce the same output, and remove their intermediate runs.
+func TestMergeWithMaxFanIn(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    int
+		maxFanIn int
+		wantPlan []app.MergePass
+		unsorted bool
+	}{
+		{
+			name: "Test_with_single_pass", files: 5, maxFanIn: 5,
+			wantPlan: []app.MergePass{{Inputs: 5, Outputs: 1}},
+		},
+		{
+			name: "Test_with_three_passes", files: 20, maxFanIn: 3,
+			wantPlan: []app.MergePass{{Inputs: 20, Outputs: 7}, {Inputs: 7, Outputs: 3}, {Inputs: 3, Outputs: 1}},
+		},
+		{
+			name: "Test_with_unsorted_input", files: 20, maxFanIn: 3, unsorted: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			tempDir := t.TempDir()
+			var inputFiles []string
+			var want []int32
+			for i := 0; i < tt.files; i++ {
+				values := []int32{int32(i), int32(i + 10), int32(i + 20)}
+				content := fmt.Sprintf("%d %d %d\n", values[0], values[1], values[2])
+				if tt.unsorted && i == tt.files-1 {
+					content = fmt.Sprintf("%d %d %d\n", values[2], values[1], values[0])
+				}
+				filename := filepath.Join(dataDir, fmt.Sprintf("input_%02d.txt", i))
+				if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write input file: %v", err)
+				}
+				inputFiles = append(inputFiles, filename)
+				want = append(want, values...)
+			}
+			slices.Sort(want)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			var plan []app.MergePass
+			err := app.Merge(inputFiles, outputFile, parseInt32, formatInt32, lessInt32,
+				app.WithMaxFanIn(tt.maxFanIn), app.WithMergePlan(&plan), app.WithTempDir(tempDir))
+			if tt.unsorted {
+				if err == nil || !strings.Contains(err.Error(), inputFiles[tt.files-1]+" is not sorted") {
+					t.Errorf("Merge error = %v, want error naming unsorted file %s", err, inputFiles[tt.files-1])
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Failed to merge files: %v", err)
+				}
+				got, err := readInt32s(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("Merged values = %v, want %v", got, want)
+				}
+				if !slices.Equal(plan, tt.wantPlan) {
+					t.Errorf("Merge plan = %v, want %v", plan, tt.wantPlan)
+				}
+			}
+
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to read temporary directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Temporary directory has %d entries after the merge, want 0", len(entries))
+			}
+		})
+	}
+}
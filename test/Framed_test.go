@@ -0,0 +1,150 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// frame returns payloads framed with framing, back to back.
+func frame(framing app.Framing, payloads [][]byte) []byte {
+	var b []byte
+	for _, payload := range payloads {
+		if framing == app.FrameUvarint {
+			b = binary.AppendUvarint(b, uint64(len(payload)))
+		} else {
+			b = binary.BigEndian.AppendUint32(b, uint32(len(payload)))
+		}
+		b = append(b, payload...)
+	}
+	return b
+}
+
+// TestRunFramed tests that length-prefixed records with payloads of any bytes are sorted by
+// their keys and written framed, in inputs rewritten in place, in spilled runs and in
+// intermediate passes.
+func TestRunFramed(t *testing.T) {
+	// The key of a payload is the bytes after its first byte
+	key := func(payload []byte) []byte { return payload[min(len(payload), 1):] }
+	modes := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "in_place"},
+		{name: "with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(4 << 10), app.WithConcurrency(1)}},
+		{name: "with_passes", opts: []app.Option{app.WithMaxFanIn(2), app.WithParallelMerge(4)}},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, framing := range []app.Framing{app.FrameUvarint, app.FrameFixed32} {
+		for _, mode := range modes {
+			t.Run("Test_framing_"+strconv.Itoa(int(framing))+"_"+mode.name, func(t *testing.T) {
+				dataDir := t.TempDir()
+				var inputFiles []string
+				var want [][]byte
+				for i := 0; i < 4; i++ {
+					var payloads [][]byte
+					for j := 0; j < 100*i; j++ {
+						// Payloads hold newlines, NULs and anything else, and may be long or empty
+						payload := make([]byte, rng.Intn(300))
+						rng.Read(payload)
+						payloads = append(payloads, payload)
+					}
+					payloads = append(payloads, []byte("x\n\x00y"), nil)
+					want = append(want, payloads...)
+					filename := filepath.Join(dataDir, "input_"+strconv.Itoa(i)+".bin")
+					if err := os.WriteFile(filename, frame(framing, payloads), 0644); err != nil {
+						t.Fatalf("Failed to write input file: %v", err)
+					}
+					inputFiles = append(inputFiles, filename)
+				}
+				slices.SortStableFunc(want, func(a, b []byte) int { return bytes.Compare(key(a), key(b)) })
+				outputFile := filepath.Join(dataDir, "out.bin")
+
+				opts := append([]app.Option{app.WithTempDir(t.TempDir()), app.WithStable(true)}, mode.opts...)
+				if err := app.RunFramed(inputFiles, outputFile, framing, app.CompareKeys(key), opts...); err != nil {
+					t.Fatalf("Failed to run K-Way Merger: %v", err)
+				}
+
+				got, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if !bytes.Equal(got, frame(framing, want)) {
+					t.Errorf("Output of %d bytes differs from the %d sorted records", len(got), len(want))
+				}
+			})
+		}
+	}
+}
+
+// TestMergeFramed tests that sorted framed records are merged by their whole payloads, and
+// that unsorted inputs, partial records and records over the maximum record size fail.
+func TestMergeFramed(t *testing.T) {
+	dataDir := t.TempDir()
+	write := func(name string, content []byte) string {
+		filename := filepath.Join(dataDir, name)
+		if err := os.WriteFile(filename, content, 0644); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		return filename
+	}
+	payloads := func(s ...string) [][]byte {
+		var list [][]byte
+		for _, p := range s {
+			list = append(list, []byte(p))
+		}
+		return list
+	}
+
+	files := []string{
+		write("a.bin", frame(app.FrameUvarint, payloads("a b", "c\n"))),
+		write("b.bin", frame(app.FrameUvarint, payloads("a\x00", "b"))),
+	}
+	outputFile := filepath.Join(dataDir, "out.bin")
+	if err := app.MergeFramed(files, outputFile, app.FrameUvarint, app.CompareKeys(nil)); err != nil {
+		t.Fatalf("Failed to merge framed records: %v", err)
+	}
+	got, _ := os.ReadFile(outputFile)
+	if want := frame(app.FrameUvarint, payloads("a\x00", "a b", "b", "c\n")); !bytes.Equal(got, want) {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+
+	// A payload of 31 bytes starting with 8b 08 frames like the start of a gzip stream
+	magic := frame(app.FrameUvarint, payloads("\x8b\x08"+strings.Repeat("z", 29)))
+	files = []string{write("magic.bin", magic), write("empty.bin", nil)}
+	if err := app.MergeFramed(files, outputFile, app.FrameUvarint, app.CompareKeys(nil)); err != nil {
+		t.Fatalf("Failed to merge framed records: %v", err)
+	}
+	if got, _ = os.ReadFile(outputFile); !bytes.Equal(got, magic) {
+		t.Errorf("Output = %q, want %q", got, magic)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		opts    []app.Option
+		wantErr string
+	}{
+		{name: "Test_unsorted", content: frame(app.FrameFixed32, payloads("b", "a")), wantErr: "not sorted"},
+		{name: "Test_partial_prefix", content: []byte{0, 0, 1}, wantErr: "partial record"},
+		{name: "Test_partial_payload", content: []byte{0, 0, 0, 5, 'a'}, wantErr: "partial record"},
+		{name: "Test_too_long", content: frame(app.FrameFixed32, payloads(strings.Repeat("a", 5000))),
+			opts: []app.Option{app.WithMaxRecordSize(4096)}, wantErr: "maximum record size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := write(tt.name+".bin", tt.content)
+			err := app.MergeFramed([]string{file}, filepath.Join(dataDir, "out_"+tt.name+".bin"), app.FrameFixed32, app.CompareKeys(nil), tt.opts...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Merge returned %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunJSON tests that JSON Lines records are sorted by the typed key at a field path and
+// written back unchanged, in inputs rewritten in place, in spilled runs and in parallel merges.
+func TestRunJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		keyType  app.JSONKeyType
+		contents []string
+		want     string
+	}{
+		{
+			name:     "Test_number_keys",
+			path:     "n",
+			keyType:  app.JSONNumber,
+			contents: []string{`{"n": 10, "s": "x"}` + "\n" + `{"n":-2.5}` + "\n", `{"n":9}` + "\n" + `{"m":1}` + "\n", `{"n":1e1,"t":true}`},
+			want:     `{"m":1}` + "\n" + `{"n":-2.5}` + "\n" + `{"n":9}` + "\n" + `{"n": 10, "s": "x"}` + "\n" + `{"n":1e1,"t":true}` + "\n",
+		},
+		{
+			name:     "Test_integer_keys_beyond_float64_precision",
+			path:     "ts",
+			keyType:  app.JSONNumber,
+			contents: []string{`{"ts":1700000000000000001}` + "\n" + `{"ts":9223372036854775807}` + "\n", `{"ts":1e19}` + "\n" + `{"ts":1700000000000000000}` + "\n", `{"ts":1.7e18}` + "\n" + `{"ts":-9223372036854775808}` + "\n" + `{"ts":-1e19}`},
+			want:     `{"ts":-1e19}` + "\n" + `{"ts":-9223372036854775808}` + "\n" + `{"ts":1700000000000000000}` + "\n" + `{"ts":1.7e18}` + "\n" + `{"ts":1700000000000000001}` + "\n" + `{"ts":9223372036854775807}` + "\n" + `{"ts":1e19}` + "\n",
+		},
+		{
+			name:     "Test_string_keys_by_path",
+			path:     "meta.id",
+			keyType:  app.JSONString,
+			contents: []string{`{"meta":{"id":"b"}}` + "\n" + `{"meta":{"id":"c"}}` + "\n", `{"meta":{"id":"a","x":[1,2]}}` + "\n" + `{"meta":null}` + "\n"},
+			want:     `{"meta":null}` + "\n" + `{"meta":{"id":"a","x":[1,2]}}` + "\n" + `{"meta":{"id":"b"}}` + "\n" + `{"meta":{"id":"c"}}` + "\n",
+		},
+		{
+			name:     "Test_time_keys",
+			path:     "meta.ts",
+			keyType:  app.JSONTime,
+			contents: []string{`{"meta":{"ts":"2024-01-01T09:30:00Z"}}` + "\n", `{"meta":{"ts":"2024-01-01T10:00:00+02:00"}}` + "\n" + `{"meta":{"ts":"2024-01-01T09:30:00.5Z"}}` + "\n"},
+			want:     `{"meta":{"ts":"2024-01-01T10:00:00+02:00"}}` + "\n" + `{"meta":{"ts":"2024-01-01T09:30:00Z"}}` + "\n" + `{"meta":{"ts":"2024-01-01T09:30:00.5Z"}}` + "\n",
+		},
+	}
+	modes := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "in_place"},
+		{name: "with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(40), app.WithConcurrency(1)}},
+		{name: "with_parallel_merge", opts: []app.Option{app.WithParallelMerge(2), app.WithMaxFanIn(2)}},
+	}
+	for _, tt := range tests {
+		for _, mode := range modes {
+			t.Run(tt.name+"_"+mode.name, func(t *testing.T) {
+				dataDir := t.TempDir()
+				inputFiles := writeInputs(t, dataDir, ".jsonl", tt.contents)
+				outputFile := filepath.Join(dataDir, "out.jsonl")
+
+				opts := append([]app.Option{app.WithLines(), app.WithStable(true), app.WithTempDir(t.TempDir())}, mode.opts...)
+				if err := app.Run(inputFiles, outputFile, app.ParseJSON(tt.path, tt.keyType), app.FormatJSON, app.CompareJSON, opts...); err != nil {
+					t.Fatalf("Failed to run K-Way Merger: %v", err)
+				}
+
+				got, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("Output = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestMergeStreamsJSONErrors tests that lines that are not JSON objects and keys of the wrong
+// type fail the merge.
+func TestMergeStreamsJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType app.JSONKeyType
+		line    string
+	}{
+		{name: "Test_invalid_JSON", keyType: app.JSONNumber, line: `{"ts":`},
+		{name: "Test_not_an_object", keyType: app.JSONNumber, line: `[1,2]`},
+		{name: "Test_trailing_data", keyType: app.JSONNumber, line: `{"ts":1} {"ts":2}`},
+		{name: "Test_string_as_number", keyType: app.JSONNumber, line: `{"ts":"1"}`},
+		{name: "Test_number_as_string", keyType: app.JSONString, line: `{"ts":1}`},
+		{name: "Test_invalid_time", keyType: app.JSONTime, line: `{"ts":"yesterday"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := []io.Reader{strings.NewReader(tt.line + "\n")}
+			var out bytes.Buffer
+			if err := app.MergeStreams(inputs, &out, app.ParseJSON("ts", tt.keyType), app.FormatJSON, app.CompareJSON, app.WithLines()); err == nil {
+				t.Errorf("Merge of %s succeeded, want an error", tt.line)
+			}
+		})
+	}
+}
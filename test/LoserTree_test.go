@@ -0,0 +1,131 @@
+package test
+
+import (
+	"KWayMerger/app"
+	myHeap "KWayMerger/heap"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// queue is the interface shared by the heap and the loser tree.
+type queue interface {
+	PushNode(node myHeap.Node[int])
+	PopNode() myHeap.Node[int]
+	Empty() bool
+}
+
+// mergeWithQueue merges the sorted lists with q, replacing each popped node by the next
+// value of its list, and returns the merged values together with their list indices.
+func mergeWithQueue(q queue, lists [][]int) (vals, indices []int) {
+	next := make([]int, len(lists))
+	for i, list := range lists {
+		if len(list) > 0 {
+			q.PushNode(myHeap.Node[int]{Val: list[0], Index: i})
+			next[i] = 1
+		}
+	}
+	for !q.Empty() {
+		node := q.PopNode()
+		vals = append(vals, node.Val)
+		indices = append(indices, node.Index)
+		if list := lists[node.Index]; next[node.Index] < len(list) {
+			node.Val = list[next[node.Index]]
+			next[node.Index]++
+			q.PushNode(node)
+		}
+	}
+	return vals, indices
+}
+
+// randomSortedLists returns k sorted lists of up to n small random values, some of them empty.
+func randomSortedLists(rng *rand.Rand, k, n int) [][]int {
+	lists := make([][]int, k)
+	for i := range lists {
+		list := make([]int, rng.Intn(n+1))
+		for j := range list {
+			list[j] = rng.Intn(50)
+		}
+		slices.Sort(list)
+		lists[i] = list
+	}
+	return lists
+}
+
+// TestLoserTree tests that the loser tree merges like the heap, including stable tie-breaking.
+func TestLoserTree(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+	rng := rand.New(rand.NewSource(1))
+	for _, k := range []int{1, 2, 3, 7, 8, 33} {
+		t.Run(fmt.Sprintf("Test_with_%d_inputs", k), func(t *testing.T) {
+			lists := randomSortedLists(rng, k, 40)
+
+			wantVals, wantIndices := mergeWithQueue(myHeap.NewStableHeap(k, less), lists)
+			gotVals, gotIndices := mergeWithQueue(myHeap.NewStableLoserTree(k, less), lists)
+			if !slices.Equal(gotVals, wantVals) || !slices.Equal(gotIndices, wantIndices) {
+				t.Errorf("Stable loser tree merged %v from %v, want %v from %v", gotVals, gotIndices, wantVals, wantIndices)
+			}
+
+			gotVals, _ = mergeWithQueue(myHeap.NewLoserTree(k, less), lists)
+			if !slices.Equal(gotVals, wantVals) {
+				t.Errorf("Loser tree merged %v, want %v", gotVals, wantVals)
+			}
+		})
+	}
+}
+
+// TestMergeEngines tests that both merge engines produce the same output through the app API.
+func TestMergeEngines(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	lists := randomSortedLists(rng, 50, 100)
+	var outputs []string
+	for _, engine := range []app.MergeEngine{app.EngineHeap, app.EngineLoserTree} {
+		inputs := make([]io.Reader, len(lists))
+		for i, list := range lists {
+			inputs[i] = strings.NewReader(strings.Trim(fmt.Sprint(list), "[]"))
+		}
+		var out bytes.Buffer
+		if err := app.MergeStreams(inputs, &out, parseInt32, formatInt32, lessInt32, app.WithMergeEngine(engine)); err != nil {
+			t.Fatalf("Failed to merge inputs with engine %v: %v", engine, err)
+		}
+		outputs = append(outputs, out.String())
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("Loser tree output differs from heap output")
+	}
+}
+
+// benchmarkQueue measures merging k sorted lists with the queues returned by newQueue.
+func benchmarkQueue(b *testing.B, k int, newQueue func(k int) queue) {
+	rng := rand.New(rand.NewSource(3))
+	lists := make([][]int, k)
+	for i := range lists {
+		list := make([]int, 1000)
+		for j := range list {
+			list[j] = rng.Int()
+		}
+		slices.Sort(list)
+		lists[i] = list
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mergeWithQueue(newQueue(k), lists)
+	}
+}
+
+// BenchmarkMergeQueues compares the heap and the loser tree for different numbers of inputs.
+func BenchmarkMergeQueues(b *testing.B) {
+	less := func(a, b int) bool { return a < b }
+	for _, k := range []int{4, 64, 1024} {
+		b.Run(fmt.Sprintf("Heap_%d", k), func(b *testing.B) {
+			benchmarkQueue(b, k, func(k int) queue { return myHeap.NewHeap(k, less) })
+		})
+		b.Run(fmt.Sprintf("LoserTree_%d", k), func(b *testing.B) {
+			benchmarkQueue(b, k, func(k int) queue { return myHeap.NewLoserTree(k, less) })
+		})
+	}
+}
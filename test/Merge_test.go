@@ -0,0 +1,71 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMerge tests merging of already sorted files, including the detection of
+// inputs that are not sorted.
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []string
+		want    []int32
+		wantErr string
+	}{
+		{
+			name:   "Test_with_sorted_inputs",
+			inputs: []string{"1 4 7\n", "2 5 8\n", "-3 3 6 9 9\n"},
+			want:   []int32{-3, 1, 2, 3, 4, 5, 6, 7, 8, 9, 9},
+		},
+		{
+			name:    "Test_with_unsorted_input",
+			inputs:  []string{"1 4 7\n", "2 5 3 8\n"},
+			wantErr: "record 3 (3) is less than record 2 (5)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			inputFiles := writeInputs(t, dataDir, ".txt", tt.inputs)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			err := app.Merge(inputFiles, outputFile, parseInt32, formatInt32, lessInt32)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want error containing %q", err, tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), inputFiles[1]) {
+					t.Errorf("Merge error = %v, want it to name file %s", err, inputFiles[1])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to merge files: %v", err)
+			}
+
+			got, err := readInt32s(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Merged values = %v, want %v", got, tt.want)
+			}
+			for i, file := range inputFiles {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("Failed to read input file: %v", err)
+				}
+				if !bytes.Equal(content, []byte(tt.inputs[i])) {
+					t.Errorf("Input file %s was modified", file)
+				}
+			}
+		})
+	}
+}
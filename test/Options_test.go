@@ -0,0 +1,86 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRunWithOptions tests that the options passed to Run configure the sort and merge.
+func TestRunWithOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []app.Option
+		want     string
+		wantMode os.FileMode
+		modified bool
+	}{
+		{
+			name:     "Test_with_defaults",
+			want:     "-5\n0\n1\n2\n3\n4\n6\n7\n8\n9\n",
+			wantMode: 0644,
+			modified: true,
+		},
+		{
+			name: "Test_with_all_options",
+			opts: []app.Option{
+				app.WithConcurrency(1),
+				app.WithMemoryLimit(32),
+				app.WithPreserveInputs(true),
+				app.WithReadBufferSize(16),
+				app.WithDelimiter(","),
+				app.WithFileMode(0600),
+				app.WithSync(false),
+			},
+			want:     "-5,0,1,2,3,4,6,7,8,9,",
+			wantMode: 0600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			tempDir := t.TempDir()
+			contents := []string{"9 3 7 1\n", "8 2 6\n4 -5 0\n"}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			opts := append(tt.opts, app.WithTempDir(tempDir))
+			if err := app.Run(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Output = %q, want %q", got, tt.want)
+			}
+			info, err := os.Stat(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to stat output file: %v", err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Errorf("Output file mode = %v, want %v", info.Mode().Perm(), tt.wantMode)
+			}
+			for i, file := range inputFiles {
+				content, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("Failed to read input file: %v", err)
+				}
+				if modified := !bytes.Equal(content, []byte(contents[i])); modified != tt.modified {
+					t.Errorf("Input file %s modified = %v, want %v", file, modified, tt.modified)
+				}
+			}
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to read temporary directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Temporary directory has %d entries after the run, want 0", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRunParallelMerge tests that merging key ranges in parallel produces the same output as
+// a serial merge, also with intermediate passes and when duplicates are dropped.
+func TestRunParallelMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []app.Option
+		unique bool
+	}{
+		{name: "Test_serial", opts: []app.Option{app.WithParallelMerge(1)}},
+		{name: "Test_with_4_ranges", opts: []app.Option{app.WithParallelMerge(4)}},
+		{name: "Test_with_64_ranges", opts: []app.Option{app.WithParallelMerge(64)}},
+		{name: "Test_with_passes", opts: []app.Option{app.WithParallelMerge(4), app.WithMaxFanIn(4)}},
+		{name: "Test_with_loser_tree", opts: []app.Option{app.WithParallelMerge(4), app.WithMergeEngine(app.EngineLoserTree)}},
+		{name: "Test_unique", opts: []app.Option{app.WithParallelMerge(4)}, unique: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			inputFiles, want, err := generateInt32Inputs(dataDir, 5, 2000)
+			if err != nil {
+				t.Fatalf("Failed to generate input files: %v", err)
+			}
+			// Add a small file and an empty file
+			inputFiles = append(inputFiles, writeInputs(t, dataDir, ".txt", []string{"7 -3 7 0\n", ""})...)
+			want = append(want, 7, -3, 7, 0)
+			slices.Sort(want)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			var dropped int64
+			opts := append(tt.opts, app.WithTempDir(t.TempDir()))
+			if tt.unique {
+				opts = append(opts, app.WithUnique(&dropped))
+			}
+			if err = app.Run(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := readInt32s(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if tt.unique {
+				n := len(want)
+				want = slices.Compact(want)
+				if dropped != int64(n-len(want)) {
+					t.Errorf("Dropped = %d, want %d", dropped, n-len(want))
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("Output has %d values, want %d sorted input values", len(got), len(want))
+			}
+		})
+	}
+}
+
+// TestRunParallelMergeStable tests that parallel merges keep values that compare equal in
+// input order, even if few distinct values leave fewer ranges than requested.
+func TestRunParallelMergeStable(t *testing.T) {
+	dataDir := t.TempDir()
+	var inputFiles []string
+	var want []string
+	for i := 0; i < 3; i++ {
+		var values []string
+		for j := 0; j < 300; j++ {
+			values = append(values, string(rune('a'+j%3))+":"+strconv.Itoa(i)+"-"+strconv.Itoa(j))
+		}
+		filename := filepath.Join(dataDir, "input_"+strconv.Itoa(i)+".txt")
+		if err := os.WriteFile(filename, []byte(strings.Join(values, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write input file: %v", err)
+		}
+		inputFiles = append(inputFiles, filename)
+		want = append(want, values...)
+	}
+	slices.SortStableFunc(want, func(a, b string) int {
+		return strings.Compare(a[:1], b[:1])
+	})
+	outputFile := filepath.Join(dataDir, "out.txt")
+
+	opts := []app.Option{app.WithStable(true), app.WithParallelMerge(8), app.WithTempDir(t.TempDir())}
+	if err := app.Run(inputFiles, outputFile, parseString, formatString, lessKey, opts...); err != nil {
+		t.Fatalf("Failed to run K-Way Merger: %v", err)
+	}
+
+	got, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if string(got) != strings.Join(want, "\n")+"\n" {
+		t.Errorf("Output is not the stable merge of the inputs")
+	}
+}
+
+// TestMergeParallelUnsorted tests that parallel merges of already sorted files still detect
+// unsorted input files, wherever the values out of order are.
+func TestMergeParallelUnsorted(t *testing.T) {
+	ascending := func(from, to int) []string {
+		var values []string
+		for i := from; i < to; i++ {
+			values = append(values, strconv.Itoa(i))
+		}
+		return values
+	}
+	tests := []struct {
+		name   string
+		values []string
+	}{
+		{name: "Test_sorted", values: ascending(0, 2000)},
+		{name: "Test_with_repeated_values", values: append(ascending(0, 1000), ascending(0, 1000)...)},
+		{name: "Test_with_swapped_values", values: append(append(ascending(0, 700), "1500", "700"), ascending(701, 2000)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			inputFiles := []string{filepath.Join(dataDir, "input_a.txt"), filepath.Join(dataDir, "input_b.txt")}
+			if err := os.WriteFile(inputFiles[0], []byte(strings.Join(tt.values, "\n")+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+			if err := os.WriteFile(inputFiles[1], []byte(strings.Join(ascending(0, 2000), "\n")+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write input file: %v", err)
+			}
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			err := app.Merge(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, app.WithParallelMerge(4), app.WithTempDir(t.TempDir()))
+			sorted := slices.IsSortedFunc(tt.values, func(a, b string) int {
+				x, _ := strconv.Atoi(a)
+				y, _ := strconv.Atoi(b)
+				return x - y
+			})
+			if sorted {
+				if err != nil {
+					t.Fatalf("Failed to merge files: %v", err)
+				}
+				got, err := readInt32s(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if len(got) != 4000 || !slices.IsSorted(got) {
+					t.Errorf("Output has %d values, sorted = %v, want 4000 sorted values", len(got), slices.IsSorted(got))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "is not sorted") {
+				t.Fatalf("Merge error = %v, want error containing %q", err, "is not sorted")
+			}
+			if !errors.Is(err, app.ErrNotSorted) {
+				t.Errorf("Merge error = %v, want an error wrapping app.ErrNotSorted", err)
+			}
+			if _, statErr := os.Stat(outputFile); !os.IsNotExist(statErr) {
+				t.Errorf("Output file exists after a failed merge")
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestRunProgress tests that runs report the start of each phase, the sorting of each input
+// and the records merged, in that order.
+func TestRunProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		merge     bool
+		opts      []app.Option
+		wantTotal int64
+	}{
+		{name: "Test_run", wantTotal: 70005},
+		{name: "Test_run_with_parallel_merge", opts: []app.Option{app.WithParallelMerge(4)}, wantTotal: 70005},
+		{name: "Test_merge", merge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			var large []string
+			for i := 0; i < 70000; i++ {
+				large = append(large, strconv.Itoa(i))
+			}
+			contents := []string{strings.Join(large, "\n") + "\n", "1 2 3\n", "4 5\n"}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			var events []app.ProgressEvent
+			opts := append(tt.opts, app.WithProgress(func(ev app.ProgressEvent) {
+				events = append(events, ev)
+			}))
+			var err error
+			if tt.merge {
+				err = app.Merge(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...)
+			} else {
+				err = app.Run(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...)
+			}
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			var phases []app.Phase
+			started := make(map[int]bool)
+			finished := make(map[int]bool)
+			var sortProgress int
+			var last app.ProgressEvent
+			for _, ev := range events {
+				switch ev.Kind {
+				case app.EventPhaseStart:
+					phases = append(phases, ev.Phase)
+				case app.EventSortStart:
+					started[ev.Input] = true
+					if ev.Name != inputFiles[ev.Input] || ev.Size != int64(len(contents[ev.Input])) {
+						t.Errorf("Sort start of input %d = %+v, want name %s and size %d", ev.Input, ev, inputFiles[ev.Input], len(contents[ev.Input]))
+					}
+				case app.EventSortProgress:
+					sortProgress++
+				case app.EventSortFinish:
+					finished[ev.Input] = true
+					wantRecords := int64(len(strings.Fields(contents[ev.Input])))
+					if ev.Records != wantRecords || ev.Bytes != int64(len(contents[ev.Input])) {
+						t.Errorf("Sort finish of input %d = %+v, want %d records and %d bytes", ev.Input, ev, wantRecords, len(contents[ev.Input]))
+					}
+				case app.EventMergeProgress:
+					if ev.Phase != app.PhaseMerge {
+						t.Errorf("Merge progress reported in phase %v", ev.Phase)
+					}
+					last = ev
+				}
+			}
+
+			wantPhases := []app.Phase{app.PhaseSort, app.PhaseMerge}
+			if tt.merge {
+				wantPhases = wantPhases[1:]
+			}
+			if len(phases) != len(wantPhases) || phases[len(phases)-1] != app.PhaseMerge || phases[0] != wantPhases[0] {
+				t.Errorf("Phases = %v, want %v", phases, wantPhases)
+			}
+			if !tt.merge && (len(started) != len(inputFiles) || len(finished) != len(inputFiles) || sortProgress == 0) {
+				t.Errorf("Sort events: %d started, %d finished, %d progress, want %d started and finished with progress",
+					len(started), len(finished), sortProgress, len(inputFiles))
+			}
+			if last.Records != 70005 || last.Total != tt.wantTotal {
+				t.Errorf("Last merge progress = %d of %d records, want 70005 of %d", last.Records, last.Total, tt.wantTotal)
+			}
+		})
+	}
+}
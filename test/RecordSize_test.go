@@ -0,0 +1,62 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunMaxRecordSize tests that records longer than the maximum record size fail the run with
+// an error naming the file and offset, and that larger or unlimited sizes accept them.
+func TestRunMaxRecordSize(t *testing.T) {
+	long := strings.Repeat("x", 100<<10)
+	tests := []struct {
+		name    string
+		merge   bool
+		opts    []app.Option
+		wantErr string
+	}{
+		{name: "Test_with_default_limit", wantErr: "input_b.txt: record at offset 6 exceeds the maximum record size of 65536 bytes"},
+		{name: "Test_with_small_limit", opts: []app.Option{app.WithMaxRecordSize(4)}, wantErr: "input_a.txt: record at offset 0 exceeds the maximum record size of 4 bytes"},
+		{name: "Test_with_large_limit", opts: []app.Option{app.WithMaxRecordSize(1 << 20)}},
+		{name: "Test_unlimited", opts: []app.Option{app.WithMaxRecordSize(app.UnlimitedRecordSize)}},
+		{name: "Test_unlimited_with_spilled_runs", opts: []app.Option{app.WithMaxRecordSize(app.UnlimitedRecordSize), app.WithMemoryLimit(1)}},
+		{name: "Test_merge_with_default_limit", merge: true, wantErr: "input_b.txt: record at offset 6 exceeds the maximum record size of 65536 bytes"},
+		{name: "Test_merge_unlimited", merge: true, opts: []app.Option{app.WithMaxRecordSize(app.UnlimitedRecordSize)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			contents := []string{"alpha\nomega\n", "beta\n\n" + long + "\nzeta\n"}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			opts := append(tt.opts, app.WithTempDir(t.TempDir()))
+			var err error
+			if tt.merge {
+				err = app.Merge(inputFiles, outputFile, parseString, formatString, lessString, opts...)
+			} else {
+				err = app.Run(inputFiles, outputFile, parseString, formatString, lessString, opts...)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if want := "alpha\nbeta\nomega\n" + long + "\nzeta\n"; string(got) != want {
+				t.Errorf("Output has %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+}
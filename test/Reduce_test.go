@@ -0,0 +1,92 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sumCounts reduces "key:count" records sharing a key to one record with the sum of their counts.
+func sumCounts(group []string) string {
+	key, _, _ := strings.Cut(group[0], ":")
+	total := 0
+	for _, record := range group {
+		_, count, _ := strings.Cut(record, ":")
+		n, _ := strconv.Atoi(count)
+		total += n
+	}
+	return key + ":" + strconv.Itoa(total)
+}
+
+// keepLast reduces records sharing a key to the last one in input order.
+func keepLast(group []string) string {
+	return group[len(group)-1]
+}
+
+// TestRunReduce tests that groups of records sharing a key are combined into one
+// output record, across input files and spilled runs.
+func TestRunReduce(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []app.Option
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "Test_with_sum",
+			opts: []app.Option{app.WithReduce(sumCounts)},
+			want: []string{"a:7", "b:5", "c:10"},
+		},
+		{
+			name: "Test_with_sum_and_spilled_runs",
+			opts: []app.Option{app.WithReduce(sumCounts), app.WithMemoryLimit(48), app.WithConcurrency(1)},
+			want: []string{"a:7", "b:5", "c:10"},
+		},
+		{
+			name: "Test_with_latest",
+			opts: []app.Option{app.WithReduce(keepLast), app.WithStable(true)},
+			want: []string{"a:4", "b:2", "c:6"},
+		},
+		{
+			name: "Test_with_unique_replacing_reduce",
+			opts: []app.Option{app.WithReduce(keepLast), app.WithUnique(nil), app.WithStable(true)},
+			want: []string{"a:1", "b:3", "c:1"},
+		},
+		{
+			name:    "Test_with_mismatched_reduce_func",
+			opts:    []app.Option{app.WithReduce(func(group []int32) int32 { return group[0] })},
+			wantErr: "cannot reduce values of type string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			contents := []string{"c:1 a:1 b:3 c:3\n", "a:2 c:6 b:2\n", "a:4\n"}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			opts := append(tt.opts, app.WithTempDir(t.TempDir()))
+			err := app.Run(inputFiles, outputFile, parseString, formatString, lessKey, opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if want := strings.Join(tt.want, "\n") + "\n"; string(got) != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestMergeSeq tests ranging over the merged values of already sorted files,
+// including stopping early and the detection of inputs that are not sorted.
+func TestMergeSeq(t *testing.T) {
+	dataDir := t.TempDir()
+	inputFiles := writeInputs(t, dataDir, ".txt", []string{"1 4 7\n", "2 5 8\n", "-3 3 6 9\n"})
+
+	var got []int32
+	for val, err := range app.MergeSeq(inputFiles, parseInt32, formatInt32, lessInt32) {
+		if err != nil {
+			t.Fatalf("Failed to merge files: %v", err)
+		}
+		got = append(got, val)
+	}
+	if want := []int32{-3, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !slices.Equal(got, want) {
+		t.Errorf("Merged values = %v, want %v", got, want)
+	}
+
+	// Stopping early yields only the smallest values
+	got = got[:0]
+	for val, err := range app.MergeSeq(inputFiles, parseInt32, formatInt32, lessInt32) {
+		if err != nil {
+			t.Fatalf("Failed to merge files: %v", err)
+		}
+		if len(got) == 3 {
+			break
+		}
+		got = append(got, val)
+	}
+	if want := []int32{-3, 1, 2}; !slices.Equal(got, want) {
+		t.Errorf("Merged values = %v, want %v", got, want)
+	}
+
+	// Unsorted inputs end the iteration with an error
+	if err := os.WriteFile(inputFiles[1], []byte("2 8 5\n"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	var lastErr error
+	for _, err := range app.MergeSeq(inputFiles, parseInt32, formatInt32, lessInt32) {
+		lastErr = err
+	}
+	if lastErr == nil || !strings.Contains(lastErr.Error(), "record 3 (5) is less than record 2 (8)") {
+		t.Errorf("Merge error = %v, want error reporting the unsorted record", lastErr)
+	}
+}
+
+// TestRunSeq tests ranging over the merged values of unsorted files and that the
+// temporary directory is removed when the loop is stopped early.
+func TestRunSeq(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{name: "Test_with_full_iteration", limit: -1},
+		{name: "Test_with_early_break", limit: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			tempDir := t.TempDir()
+			inputFiles, want, err := generateInt32Inputs(dataDir, 3, 2000)
+			if err != nil {
+				t.Fatalf("Failed to generate input files: %v", err)
+			}
+			if tt.limit >= 0 {
+				want = want[:tt.limit]
+			}
+
+			var got []int32
+			for val, err := range app.RunSeq(inputFiles, parseInt32, formatInt32, lessInt32, app.WithMemoryLimit(8<<10), app.WithTempDir(tempDir)) {
+				if err != nil {
+					t.Fatalf("Failed to run K-Way Merger: %v", err)
+				}
+				if len(got) == tt.limit {
+					break
+				}
+				got = append(got, val)
+			}
+
+			if !slices.Equal(got, want) {
+				t.Errorf("Iterated %d values, want the %d smallest input values", len(got), len(want))
+			}
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to read temporary directory: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Temporary directory has %d entries after the loop, want 0", len(entries))
+			}
+		})
+	}
+}
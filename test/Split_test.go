@@ -0,0 +1,94 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunRecordSplitting tests that records are split as configured instead of into words,
+// in inputs rewritten in place, in spilled runs and in parallel merges.
+func TestRunRecordSplitting(t *testing.T) {
+	tests := []struct {
+		name     string
+		opt      app.Option
+		contents []string
+		want     string
+	}{
+		{
+			name:     "Test_with_lines",
+			opt:      app.WithLines(),
+			contents: []string{"b c\nkey value\na b\n", "c\r\na a"},
+			want:     "a a\na b\nb c\nc\nkey value\n",
+		},
+		{
+			name:     "Test_with_NUL_records",
+			opt:      app.WithRecordDelimiter(0),
+			contents: []string{"./b c\x00./a\nb\x00", "./a b\x00"},
+			want:     "./a\nb\x00./a b\x00./b c\x00",
+		},
+		{
+			name:     "Test_with_byte_delimiter",
+			opt:      app.WithRecordDelimiter(','),
+			contents: []string{"c d,a,b b", "e,a a,"},
+			want:     "a,a a,b b,c d,e,",
+		},
+		{
+			name:     "Test_with_split_func",
+			opt:      app.WithSplitFunc(bufio.ScanRunes, ""),
+			contents: []string{"dbé", "ca"},
+			want:     "abcdé",
+		},
+	}
+	modes := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "in_place"},
+		{name: "with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(40), app.WithConcurrency(1)}},
+		{name: "with_parallel_merge", opts: []app.Option{app.WithParallelMerge(2), app.WithMaxFanIn(2)}},
+	}
+	for _, tt := range tests {
+		for _, mode := range modes {
+			t.Run(tt.name+"_"+mode.name, func(t *testing.T) {
+				dataDir := t.TempDir()
+				inputFiles := writeInputs(t, dataDir, ".txt", tt.contents)
+				outputFile := filepath.Join(dataDir, "out.txt")
+
+				opts := append([]app.Option{tt.opt, app.WithTempDir(t.TempDir())}, mode.opts...)
+				if err := app.Run(inputFiles, outputFile, parseString, formatString, lessString, opts...); err != nil {
+					t.Fatalf("Failed to run K-Way Merger: %v", err)
+				}
+
+				got, err := os.ReadFile(outputFile)
+				if err != nil {
+					t.Fatalf("Failed to read output file: %v", err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("Output = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestMergeStreamsLines tests that already sorted streams of lines are merged line by line,
+// and that the output delimiter can still be changed after choosing the records.
+func TestMergeStreamsLines(t *testing.T) {
+	inputs := []io.Reader{
+		strings.NewReader("alpha beta\ngamma\n"),
+		strings.NewReader("alpha\ndelta epsilon\n"),
+	}
+	var out bytes.Buffer
+	if err := app.MergeStreams(inputs, &out, parseString, formatString, lessString, app.WithLines(), app.WithDelimiter("|")); err != nil {
+		t.Fatalf("Failed to merge streams: %v", err)
+	}
+	if want := "alpha|alpha beta|delta epsilon|gamma|"; out.String() != want {
+		t.Errorf("Output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,60 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lessKey compares "key:tag" records by their key only, so that records with
+// the same key compare equal but can still be told apart.
+func lessKey(a, b string) bool {
+	keyA, _, _ := strings.Cut(a, ":")
+	keyB, _, _ := strings.Cut(b, ":")
+	return keyA < keyB
+}
+
+// TestRunStable tests that stable runs keep records that compare equal in input order,
+// both within and across input files.
+func TestRunStable(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []app.Option
+	}{
+		{name: "Test_in_place", opts: []app.Option{app.WithStable(true)}},
+		{name: "Test_with_spilled_runs", opts: []app.Option{app.WithStable(true), app.WithMemoryLimit(64), app.WithConcurrency(1)}},
+		{name: "Test_read_only", opts: []app.Option{app.WithStable(true), app.WithPreserveInputs(true)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			contents := []string{
+				"b:a1 a:a2 c:a3 b:a4 a:a5 a:a6\n",
+				"a:b1 c:b2 b:b3 a:b4\n",
+				"c:c1 a:c2 b:c3\n",
+			}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			opts := append(tt.opts, app.WithTempDir(t.TempDir()))
+			if err := app.Run(inputFiles, outputFile, parseString, formatString, lessKey, opts...); err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			want := strings.Join([]string{
+				"a:a2", "a:a5", "a:a6", "a:b1", "a:b4", "a:c2",
+				"b:a1", "b:a4", "b:b3", "b:c3",
+				"c:a3", "c:b2", "c:c1",
+			}, "\n") + "\n"
+			if string(got) != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunStats tests that runs report the statistics of their inputs and phases, and that
+// the records of the inputs add up to the output records.
+func TestRunStats(t *testing.T) {
+	tests := []struct {
+		name          string
+		merge         bool
+		opts          []app.Option
+		wantOutput    int64
+		wantSpillRuns int64
+	}{
+		{name: "Test_in_place", wantOutput: 9},
+		{name: "Test_with_spilled_runs", opts: []app.Option{app.WithMemoryLimit(16), app.WithConcurrency(1)}, wantOutput: 9, wantSpillRuns: 2},
+		{name: "Test_read_only", opts: []app.Option{app.WithPreserveInputs(true)}, wantOutput: 9, wantSpillRuns: 3},
+		{name: "Test_unique", opts: []app.Option{app.WithUnique(nil)}, wantOutput: 6},
+		{name: "Test_merge", merge: true, wantOutput: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			contents := []string{"1 3 5 7 9\n", "2 3\n", "5 9\n"}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			var stats app.Stats
+			opts := append(tt.opts, app.WithTempDir(t.TempDir()), app.WithStats(&stats))
+			var err error
+			if tt.merge {
+				err = app.Merge(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...)
+			} else {
+				err = app.Run(inputFiles, outputFile, parseInt32, formatInt32, lessInt32, opts...)
+			}
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			if stats.OutputRecords != tt.wantOutput {
+				t.Errorf("OutputRecords = %d, want %d", stats.OutputRecords, tt.wantOutput)
+			}
+			if stats.SpillRuns != tt.wantSpillRuns {
+				t.Errorf("SpillRuns = %d, want %d", stats.SpillRuns, tt.wantSpillRuns)
+			}
+			if stats.MergeDuration <= 0 || stats.PeakHeapBytes == 0 {
+				t.Errorf("MergeDuration = %v, PeakHeapBytes = %d, want both positive", stats.MergeDuration, stats.PeakHeapBytes)
+			}
+			if tt.merge {
+				if len(stats.Inputs) != 0 || stats.SortDuration != 0 {
+					t.Errorf("Merge reported %d inputs sorted in %v, want none", len(stats.Inputs), stats.SortDuration)
+				}
+				return
+			}
+
+			if stats.SortDuration <= 0 {
+				t.Errorf("SortDuration = %v, want positive", stats.SortDuration)
+			}
+			if len(stats.Inputs) != len(inputFiles) {
+				t.Fatalf("Stats have %d inputs, want %d", len(stats.Inputs), len(inputFiles))
+			}
+			var records int64
+			for i, input := range stats.Inputs {
+				wantRecords := int64(len(strings.Fields(contents[i])))
+				if input.Name != inputFiles[i] || input.Records != wantRecords || input.Bytes != int64(len(contents[i])) || input.ParseTime <= 0 {
+					t.Errorf("Input %d = %+v, want %d records and %d bytes of %s parsed in a positive time",
+						i, input, wantRecords, len(contents[i]), inputFiles[i])
+				}
+				records += input.Records
+			}
+			if records != 9 {
+				t.Errorf("Input records add up to %d, want 9", records)
+			}
+		})
+	}
+}
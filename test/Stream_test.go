@@ -0,0 +1,140 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunStreams tests sorting and merging values read from in-memory readers.
+func TestRunStreams(t *testing.T) {
+	tests := []struct {
+		name        string
+		memoryLimit int64
+	}{
+		{name: "Test_without_limit", memoryLimit: 0},
+		{name: "Test_with_tiny_limit", memoryLimit: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := []io.Reader{
+				strings.NewReader("9 3 7 1\n"),
+				strings.NewReader(""),
+				strings.NewReader("8 2 6\n4 -5 0\n"),
+			}
+			var out bytes.Buffer
+
+			err := app.RunStreams(inputs, &out, parseInt32, formatInt32, lessInt32, app.WithMemoryLimit(tt.memoryLimit), app.WithTempDir(t.TempDir()))
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			want := "-5\n0\n1\n2\n3\n4\n6\n7\n8\n9\n"
+			if out.String() != want {
+				t.Errorf("Merged output = %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+// TestMergeStreams tests merging already sorted values read from in-memory readers.
+func TestMergeStreams(t *testing.T) {
+	inputs := []io.Reader{
+		strings.NewReader("a c e"),
+		strings.NewReader("b d f"),
+	}
+	var out bytes.Buffer
+	if err := app.MergeStreams(inputs, &out, parseString, formatString, lessString); err != nil {
+		t.Fatalf("Failed to merge inputs: %v", err)
+	}
+	if want := "a\nb\nc\nd\ne\nf\n"; out.String() != want {
+		t.Errorf("Merged output = %q, want %q", out.String(), want)
+	}
+
+	// Unsorted inputs are reported by their index
+	inputs = []io.Reader{
+		strings.NewReader("a c e"),
+		strings.NewReader("b f d"),
+	}
+	err := app.MergeStreams(inputs, io.Discard, parseString, formatString, lessString)
+	if err == nil || !strings.Contains(err.Error(), "input 1 is not sorted") {
+		t.Errorf("Merge error = %v, want error reporting unsorted input 1", err)
+	}
+}
+
+// countingWriter counts the writes to it and fails every write once limit bytes were written.
+type countingWriter struct {
+	writes int
+	size   int
+	limit  int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.size+len(p) > w.limit {
+		return 0, errors.New("disk full")
+	}
+	w.size += len(p)
+	return len(p), nil
+}
+
+// TestMergeStreamsBuffering tests that merged values are written in few buffered writes
+// and that write errors are reported, including those only seen when flushing.
+func TestMergeStreamsBuffering(t *testing.T) {
+	tests := []struct {
+		name       string
+		bufferSize int
+		limit      int
+		wantWrites int
+		wantErr    bool
+	}{
+		{name: "Test_with_default_buffer", limit: 1 << 20, wantWrites: 1},
+		{name: "Test_with_small_buffer", bufferSize: 8, limit: 1 << 20, wantWrites: 4},
+		{name: "Test_with_error_on_flush", limit: 10, wantWrites: 1, wantErr: true},
+		{name: "Test_with_error_on_write", bufferSize: 8, limit: 10, wantWrites: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := []io.Reader{
+				strings.NewReader("10 30 50 70 90"),
+				strings.NewReader("20 40 60 80"),
+			}
+			w := &countingWriter{limit: tt.limit}
+			err := app.MergeStreams(inputs, w, parseInt32, formatInt32, lessInt32, app.WithWriteBufferSize(tt.bufferSize))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Merge error = %v, want error %v", err, tt.wantErr)
+			}
+			if w.writes != tt.wantWrites {
+				t.Errorf("Merge made %d writes, want %d", w.writes, tt.wantWrites)
+			}
+		})
+	}
+}
+
+// TestNewNode tests that the deprecated NewNode still opens a file and reads its first value.
+func TestNewNode(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(filename, []byte("7 3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	node, err := app.NewNode(filename, parseInt32)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer node.Fd.Close()
+	if node.Val != 7 {
+		t.Errorf("Node value = %d, want 7", node.Val)
+	}
+	if !node.Scanner.Scan() || node.Scanner.Text() != "3" {
+		t.Errorf("Next value = %q, want %q", node.Scanner.Text(), "3")
+	}
+
+	if _, err := app.NewNode(filepath.Join(t.TempDir(), "missing.txt"), parseInt32); err == nil {
+		t.Error("NewNode of a missing file succeeded, want an error")
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"KWayMerger/app"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunUnique tests that unique runs drop duplicates within and across input files
+// and report the number of dropped values.
+func TestRunUnique(t *testing.T) {
+	tests := []struct {
+		name        string
+		less        func(a, b string) bool
+		opts        func(dropped *int64) []app.Option
+		want        []string
+		wantDropped int64
+		wantErr     string
+	}{
+		{
+			name: "Test_with_comparator",
+			less: lessString,
+			opts: func(dropped *int64) []app.Option {
+				return []app.Option{app.WithUnique(dropped)}
+			},
+			want:        []string{"a:1", "a:2", "b:1", "c:1", "c:2"},
+			wantDropped: 5,
+		},
+		{
+			name: "Test_with_key_comparator",
+			less: lessKey,
+			opts: func(dropped *int64) []app.Option {
+				return []app.Option{app.WithUnique(dropped), app.WithStable(true)}
+			},
+			want:        []string{"a:1", "b:1", "c:2"},
+			wantDropped: 7,
+		},
+		{
+			name: "Test_with_equality_func",
+			less: lessString,
+			opts: func(dropped *int64) []app.Option {
+				return []app.Option{app.WithUniqueFunc(func(a, b string) bool { return a[0] == b[0] }, dropped)}
+			},
+			want:        []string{"a:1", "b:1", "c:1"},
+			wantDropped: 7,
+		},
+		{
+			name: "Test_with_mismatched_equality_func",
+			less: lessString,
+			opts: func(dropped *int64) []app.Option {
+				return []app.Option{app.WithUniqueFunc(func(a, b int32) bool { return a == b }, dropped)}
+			},
+			wantErr: "cannot compare values of type string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			contents := []string{"c:2 a:1 b:1 a:1 c:2\n", "a:2 b:1 c:1\n", "a:1 a:2\n"}
+			inputFiles := writeInputs(t, dataDir, ".txt", contents)
+			outputFile := filepath.Join(dataDir, "out.txt")
+
+			var dropped int64
+			err := app.Run(inputFiles, outputFile, parseString, formatString, tt.less, tt.opts(&dropped)...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to run K-Way Merger: %v", err)
+			}
+
+			got, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if want := strings.Join(tt.want, "\n") + "\n"; string(got) != want {
+				t.Errorf("Output = %q, want %q", got, want)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("Dropped %d duplicates, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}